@@ -0,0 +1,133 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/docker/docker/api/types/registry"
+)
+
+// Username Azure Container Registry expects together with a refresh token.
+const acrTokenUsername = "00000000-0000-0000-0000-000000000000"
+
+// azureRegistryAuth holds the identity used to obtain registry tokens from
+// Azure Container Registry.
+type azureRegistryAuth struct {
+	tenantID        string
+	clientID        string
+	clientSecret    string
+	managedIdentity bool
+}
+
+// acrAuthConfig exchanges an Azure AD access token of the identity for an ACR
+// refresh token, the same way az acr login does, and returns it as
+// credentials for address.
+func acrAuthConfig(ctx context.Context, httpClient *http.Client, address string, identity azureRegistryAuth) (registry.AuthConfig, error) {
+	authConfig := registry.AuthConfig{}
+
+	accessToken, err := azureAccessToken(ctx, httpClient, identity)
+	if err != nil {
+		return authConfig, fmt.Errorf("unable to get Azure AD access token: %w", err)
+	}
+
+	form := url.Values{
+		"grant_type":   {"access_token"},
+		"service":      {address},
+		"access_token": {accessToken},
+	}
+	if identity.tenantID != "" {
+		form.Set("tenant", identity.tenantID)
+	}
+
+	var exchange struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	err = azureTokenRequest(ctx, httpClient, http.MethodPost, "https://"+address+"/oauth2/exchange", form, nil, &exchange)
+	if err != nil {
+		return authConfig, fmt.Errorf("unable to exchange Azure AD access token for a registry token: %w", err)
+	}
+
+	authConfig.Username = acrTokenUsername
+	authConfig.Password = exchange.RefreshToken
+	authConfig.ServerAddress = address
+
+	return authConfig, nil
+}
+
+// azureAccessToken gets an Azure AD access token for Azure Resource Manager,
+// either from the instance metadata service for managed identities or with
+// the client credentials of a service principal.
+func azureAccessToken(ctx context.Context, httpClient *http.Client, identity azureRegistryAuth) (string, error) {
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+
+	if identity.managedIdentity {
+		query := url.Values{
+			"api-version": {"2018-02-01"},
+			"resource":    {"https://management.azure.com/"},
+		}
+		if identity.clientID != "" {
+			query.Set("client_id", identity.clientID)
+		}
+
+		err := azureTokenRequest(ctx, httpClient, http.MethodGet, "http://169.254.169.254/metadata/identity/oauth2/token?"+query.Encode(), nil, map[string]string{"Metadata": "true"}, &token)
+		return token.AccessToken, err
+	}
+
+	if identity.tenantID == "" || identity.clientID == "" || identity.clientSecret == "" {
+		return "", fmt.Errorf("tenant_id, client_id and client_secret are required unless managed_identity is set")
+	}
+
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {identity.clientID},
+		"client_secret": {identity.clientSecret},
+		"scope":         {"https://management.azure.com/.default"},
+	}
+
+	err := azureTokenRequest(ctx, httpClient, http.MethodPost, "https://login.microsoftonline.com/"+url.PathEscape(identity.tenantID)+"/oauth2/v2.0/token", form, nil, &token)
+	return token.AccessToken, err
+}
+
+// azureTokenRequest sends form, if any, to endpoint and decodes the JSON
+// response into result.
+func azureTokenRequest(ctx context.Context, httpClient *http.Client, method string, endpoint string, form url.Values, headers map[string]string, result any) error {
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, body)
+	if err != nil {
+		return err
+	}
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s: %s", endpoint, resp.Status, string(respBody))
+	}
+
+	return json.Unmarshal(respBody, result)
+}
@@ -0,0 +1,85 @@
+package provider
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// parseBuildArgFile reads a dotenv-style file, as used by the env_file of
+// compose, into build arguments. Lines are KEY=VALUE pairs, optionally
+// prefixed with export, with values optionally in single or double quotes.
+// Blank lines and lines starting with # are ignored, and a KEY without a value
+// takes its value from the environment.
+func parseBuildArgFile(name string) (map[string]string, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	buildArgs := map[string]string{}
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		key, value, found := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if key == "" || strings.ContainsAny(key, " \t") {
+			return nil, fmt.Errorf("%s:%d: invalid build argument %q", name, lineNumber, line)
+		}
+		if !found {
+			if envValue, ok := os.LookupEnv(key); ok {
+				buildArgs[key] = envValue
+			}
+			continue
+		}
+
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			quote := value[0]
+			value = value[1 : len(value)-1]
+
+			// Escapes are only expanded in double quotes
+			if quote == '"' {
+				value = strings.NewReplacer(`\n`, "\n", `\"`, `"`, `\\`, `\`).Replace(value)
+			}
+		} else if comment := strings.Index(value, " #"); comment >= 0 {
+			value = strings.TrimSpace(value[:comment])
+		}
+		buildArgs[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return buildArgs, nil
+}
+
+// mergeBuildArgs merges the build arguments of the files, in order, and then
+// buildArgs, with later values taking precedence over earlier ones.
+func mergeBuildArgs(files []string, buildArgs map[string]string) (map[string]*string, error) {
+	merged := map[string]*string{}
+	for _, name := range files {
+		fileArgs, err := parseBuildArgFile(name)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range fileArgs {
+			merged[key] = &value
+		}
+	}
+
+	for key, value := range buildArgs {
+		merged[key] = &value
+	}
+
+	return merged, nil
+}
@@ -0,0 +1,170 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	controlapi "github.com/moby/buildkit/api/services/control"
+)
+
+// Maximum size of the build_log of docker_image. Older output is dropped, as
+// the end of the output is the part that explains a failed build.
+const buildLogLimit = 64 * 1024
+
+// buildLog collects the output of a build, keeping only its last
+// buildLogLimit bytes.
+type buildLog struct {
+	output    []byte
+	truncated bool
+}
+
+func (l *buildLog) Write(p []byte) (int, error) {
+	l.output = append(l.output, p...)
+	if len(l.output) > buildLogLimit {
+		l.output = l.output[len(l.output)-buildLogLimit:]
+		l.truncated = true
+	}
+
+	return len(p), nil
+}
+
+func (l *buildLog) String() string {
+	if l.truncated {
+		return "[earlier output truncated]\n" + string(l.output)
+	}
+
+	return string(l.output)
+}
+
+// Number of lines of the build output included in the error of a failed
+// build. The complete output is available in the debug logs.
+const buildErrorLines = 20
+
+// tail returns the last lines of the output.
+func (l *buildLog) tail(lines int) string {
+	output := strings.Split(strings.TrimRight(string(l.output), "\n"), "\n")
+	if len(output) > lines {
+		output = output[len(output)-lines:]
+	}
+
+	return strings.Join(output, "\n")
+}
+
+// Aux ID of the messages holding BuildKit progress.
+const buildKitTraceID = "moby.buildkit.trace"
+
+// buildProgress tracks the steps of a build across the messages of the daemon,
+// so that each step is logged at INFO level when it starts and finishes.
+type buildProgress struct {
+	// BuildKit steps already written, by digest
+	started   map[string]bool
+	completed map[string]bool
+
+	// Current step of the classic builder
+	step        string
+	stepStarted time.Time
+	stepCached  bool
+}
+
+func newBuildProgress() *buildProgress {
+	return &buildProgress{
+		started:   map[string]bool{},
+		completed: map[string]bool{},
+	}
+}
+
+// Step lines of the classic builder, e.g. "Step 2/5 : RUN make".
+var classicStepPattern = regexp.MustCompile(`^Step (\d+)/(\d+) : (.*)$`)
+
+// Step names of BuildKit, e.g. "[2/5] RUN make" or "[builder 2/5] RUN make".
+var buildKitStepPattern = regexp.MustCompile(`^\[(?:\S+ )?(\d+)/(\d+)\] (.*)$`)
+
+// classicOutput logs the steps found in output of the classic builder.
+func (p *buildProgress) classicOutput(ctx context.Context, output string) {
+	for _, line := range strings.Split(output, "\n") {
+		if match := classicStepPattern.FindStringSubmatch(strings.TrimSpace(line)); match != nil {
+			p.finishClassicStep(ctx)
+
+			p.step = match[1] + "/" + match[2]
+			p.stepStarted = time.Now()
+			p.stepCached = false
+			tflog.Info(ctx, "Build step started", map[string]any{"step": p.step, "command": match[3]})
+		} else if strings.TrimSpace(line) == "---> Using cache" {
+			p.stepCached = true
+		}
+	}
+}
+
+// finishClassicStep logs the end of the current step of the classic builder,
+// which is only known once the next one starts or the build ends.
+func (p *buildProgress) finishClassicStep(ctx context.Context) {
+	if p.step == "" {
+		return
+	}
+
+	tflog.Info(ctx, "Build step finished", map[string]any{
+		"step":     p.step,
+		"duration": time.Since(p.stepStarted).Round(time.Millisecond).String(),
+		"cached":   p.stepCached,
+	})
+	p.step = ""
+}
+
+// buildKitTrace writes the steps and their output from a BuildKit progress
+// message to output, in the style of docker build --progress=plain, and logs
+// each step as it starts and finishes.
+func (p *buildProgress) buildKitTrace(ctx context.Context, aux json.RawMessage, output io.Writer) error {
+	var encoded []byte
+	if err := json.Unmarshal(aux, &encoded); err != nil {
+		return err
+	}
+
+	var status controlapi.StatusResponse
+	if err := status.Unmarshal(encoded); err != nil {
+		return err
+	}
+
+	for _, vertex := range status.Vertexes {
+		digest := vertex.Digest.String()
+		fields := buildKitStepFields(vertex.Name)
+		if vertex.Started != nil && !p.started[digest] {
+			p.started[digest] = true
+			fmt.Fprintf(output, "%s\n", vertex.Name)
+			tflog.Info(ctx, "Build step started", fields)
+		}
+		if vertex.Completed != nil && !p.completed[digest] {
+			p.completed[digest] = true
+			fields["cached"] = vertex.Cached
+			if vertex.Started != nil {
+				fields["duration"] = vertex.Completed.Sub(*vertex.Started).Round(time.Millisecond).String()
+			}
+			tflog.Info(ctx, "Build step finished", fields)
+		}
+		if vertex.Error != "" {
+			fmt.Fprintf(output, "ERROR: %s: %s\n", vertex.Name, vertex.Error)
+		}
+	}
+
+	for _, log := range status.Logs {
+		fmt.Fprintf(output, "%s", log.Msg)
+		tflog.Debug(ctx, "Build output", map[string]any{"output": strings.TrimRight(string(log.Msg), "\n")})
+	}
+
+	return nil
+}
+
+// buildKitStepFields returns the log fields of a BuildKit step, splitting
+// the step number from the command if the step comes from the Dockerfile.
+func buildKitStepFields(name string) map[string]any {
+	if match := buildKitStepPattern.FindStringSubmatch(name); match != nil {
+		return map[string]any{"step": match[1] + "/" + match[2], "command": match[3]}
+	}
+
+	return map[string]any{"command": name}
+}
@@ -0,0 +1,275 @@
+package provider
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	cliconfig "github.com/docker/cli/cli/config"
+	clitypes "github.com/docker/cli/cli/config/types"
+	dockertypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/registry"
+	"github.com/docker/docker/client"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	buildkitclient "github.com/moby/buildkit/client"
+	"github.com/moby/buildkit/session"
+	"github.com/moby/buildkit/session/auth/authprovider"
+	"github.com/moby/buildkit/session/filesync"
+	"github.com/tonistiigi/fsutil"
+)
+
+// Values of the builder attribute of docker_image.
+const (
+	builderClassic  = "classic"
+	builderBuildKit = "buildkit"
+)
+
+// useBuildKit reports whether to build with BuildKit. Unless builder selects
+// a builder explicitly, BuildKit is used if the daemon reports it as its
+// default builder.
+func useBuildKit(ctx context.Context, c *client.Client, builder string) (bool, error) {
+	switch builder {
+	case builderBuildKit:
+		return true, nil
+	case builderClassic:
+		return false, nil
+	case "":
+		ping, err := c.Ping(ctx)
+		if err != nil {
+			return false, err
+		}
+		return ping.BuilderVersion == dockertypes.BuilderBuildKit, nil
+	default:
+		return false, fmt.Errorf("unknown builder %q, expected %q or %q", builder, builderBuildKit, builderClassic)
+	}
+}
+
+// newBuildSession starts a BuildKit session on the /session endpoint of the
+// daemon. During the build, BuildKit calls back into the session for
+// registry credentials and for anything provided by attachables, such as
+// build secrets. The session must be closed once the build has finished.
+// Sessions with the same sharedKey share the build context cached by
+// BuildKit, so that only changed files are transferred.
+func newBuildSession(ctx context.Context, c *client.Client, registryAuths map[string]registry.AuthConfig, configDir string, sharedKey string, attachables ...session.Attachable) (*session.Session, error) {
+	buildSession, err := session.NewSession(ctx, "terraform-provider-docker", sharedKey)
+	if err != nil {
+		return nil, err
+	}
+
+	authProvider, err := buildAuthProvider(registryAuths, configDir)
+	if err != nil {
+		return nil, err
+	}
+
+	buildSession.Allow(authProvider)
+	for _, attachable := range attachables {
+		buildSession.Allow(attachable)
+	}
+
+	go func() {
+		err := buildSession.Run(ctx, func(ctx context.Context, proto string, meta map[string][]string) (net.Conn, error) {
+			return c.DialHijack(ctx, "/session", proto, meta)
+		})
+		if err != nil {
+			tflog.Debug(ctx, "BuildKit session ended: "+err.Error())
+		}
+	}()
+
+	return buildSession, nil
+}
+
+// buildAuthProvider returns the session attachable through which BuildKit
+// reads registry credentials: those of the provider, then the ones stored by
+// docker login in configDir.
+func buildAuthProvider(registryAuths map[string]registry.AuthConfig, configDir string) (session.Attachable, error) {
+	configFile, err := cliconfig.Load(configDir)
+	if err != nil {
+		return nil, err
+	}
+
+	// Credentials of the provider take precedence over the ones stored by
+	// docker login, including those kept by credential helpers
+	if configFile.CredentialHelpers == nil {
+		configFile.CredentialHelpers = map[string]string{}
+	}
+	for address, authConfig := range buildAuthConfigs(registryAuths) {
+		configFile.AuthConfigs[address] = clitypes.AuthConfig{
+			Username:      authConfig.Username,
+			Password:      authConfig.Password,
+			Auth:          authConfig.Auth,
+			ServerAddress: authConfig.ServerAddress,
+			IdentityToken: authConfig.IdentityToken,
+			RegistryToken: authConfig.RegistryToken,
+		}
+		configFile.CredentialHelpers[address] = ""
+	}
+
+	return authprovider.NewDockerAuthProvider(configFile, nil), nil
+}
+
+// Build argument that makes BuildKit embed cache metadata in the image.
+const inlineCacheBuildArg = "BUILDKIT_INLINE_CACHE"
+
+// parseCacheExporters parses cache_to entries in the syntax of docker buildx
+// build --cache-to, e.g. "type=inline" or "type=registry,ref=...,mode=max",
+// into the cache exporters of a BuildKit solve.
+func parseCacheExporters(cacheTo []string) ([]buildkitclient.CacheOptionsEntry, error) {
+	exporters := []buildkitclient.CacheOptionsEntry{}
+
+	for _, exporter := range cacheTo {
+		attributes := map[string]string{}
+		for _, field := range strings.Split(exporter, ",") {
+			key, value, found := strings.Cut(strings.TrimSpace(field), "=")
+			if !found {
+				return nil, fmt.Errorf("invalid cache exporter %q, expected key=value pairs", exporter)
+			}
+			attributes[key] = value
+		}
+
+		exporterType := attributes["type"]
+		delete(attributes, "type")
+		switch exporterType {
+		case "inline":
+		case "registry":
+			if attributes["ref"] == "" {
+				return nil, fmt.Errorf("cache exporter %q requires ref, e.g. type=registry,ref=registry.local:5000/app:buildcache", exporter)
+			}
+		case "local":
+			if attributes["dest"] == "" {
+				return nil, fmt.Errorf("cache exporter %q requires dest, e.g. type=local,dest=/tmp/buildcache", exporter)
+			}
+		default:
+			return nil, fmt.Errorf("unknown type of cache exporter %q, expected inline, registry or local", exporter)
+		}
+
+		exporters = append(exporters, buildkitclient.CacheOptionsEntry{Type: exporterType, Attrs: attributes})
+	}
+
+	return exporters, nil
+}
+
+// cacheExportBuildArgs returns the build arguments that make BuildKit export
+// the inline cache of exporters, the only cache the BuildKit of the daemon can
+// export.
+func cacheExportBuildArgs(exporters []buildkitclient.CacheOptionsEntry) map[string]*string {
+	buildArgs := map[string]*string{}
+
+	for _, exporter := range exporters {
+		if exporter.Type == "inline" {
+			enabled := "1"
+			buildArgs[inlineCacheBuildArg] = &enabled
+		}
+	}
+
+	return buildArgs
+}
+
+// buildOutputTarget returns the session attachable through which the
+// BuildKit of the daemon sends the result of a build to output, instead of
+// storing it as an image.
+func buildOutputTarget(output dockertypes.ImageBuildOutput) session.Attachable {
+	dest := output.Attrs["dest"]
+	if output.Type == "local" {
+		return filesync.NewFSSyncTarget(filesync.WithFSSyncDir(0, dest))
+	}
+
+	return filesync.NewFSSyncTarget(filesync.WithFSSync(0, func(map[string]string) (io.WriteCloser, error) {
+		return os.Create(dest)
+	}))
+}
+
+// localContextSource returns the session attachable through which BuildKit
+// reads the build context at dir and the Dockerfile, transferring only the
+// files changed since the last build with the same session shared key. If
+// dockerFileContent is set, the Dockerfile is read from a temporary directory
+// of its own, which is returned so that it can be removed after the build.
+// The paths matched by excludes are left out of the context.
+func localContextSource(dir string, dockerFileContent string, excludes []string) (session.Attachable, string, error) {
+	dirFS, err := fsutil.NewFS(dir)
+	if err != nil {
+		return nil, "", err
+	}
+	contextFS, err := excludeFromContext(dirFS, excludes)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if dockerFileContent == "" {
+		return filesync.NewFSSyncProvider(filesync.StaticDirSource{"context": contextFS, "dockerfile": dirFS}), "", nil
+	}
+
+	dockerFileDir, err := writeDockerfileContent(dockerFileContent)
+	if err != nil {
+		return nil, "", err
+	}
+
+	dockerFileFS, err := fsutil.NewFS(dockerFileDir)
+	if err != nil {
+		os.RemoveAll(dockerFileDir)
+		return nil, "", err
+	}
+
+	return filesync.NewFSSyncProvider(filesync.StaticDirSource{"context": contextFS, "dockerfile": dockerFileFS}), dockerFileDir, nil
+}
+
+// excludeFromContext returns contextFS without the paths matched by excludes.
+func excludeFromContext(contextFS fsutil.FS, excludes []string) (fsutil.FS, error) {
+	if len(excludes) == 0 {
+		return contextFS, nil
+	}
+
+	return fsutil.NewFilterFS(contextFS, &fsutil.FilterOpt{ExcludePatterns: excludes})
+}
+
+// writeDockerfileContent writes dockerfile_content as the Dockerfile of a new
+// temporary directory, which the caller must remove.
+func writeDockerfileContent(dockerFileContent string) (string, error) {
+	dockerFileDir, err := os.MkdirTemp("", "terraform-provider-docker-")
+	if err != nil {
+		return "", fmt.Errorf("unable to write dockerfile_content: %w", err)
+	}
+
+	err = os.WriteFile(filepath.Join(dockerFileDir, "Dockerfile"), []byte(dockerFileContent), 0o644)
+	if err != nil {
+		os.RemoveAll(dockerFileDir)
+		return "", fmt.Errorf("unable to write dockerfile_content: %w", err)
+	}
+
+	return dockerFileDir, nil
+}
+
+// contextSharedKey returns the session shared key of the build context at
+// dir, which stays the same across builds of the same directory.
+func contextSharedKey(dir string) string {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		absDir = dir
+	}
+
+	hash := sha256.Sum256([]byte(absDir))
+	return "terraform-provider-docker:" + hex.EncodeToString(hash[:])
+}
+
+// sessionBody closes the BuildKit session of a build together with the body
+// of its response, as the session is needed until the build has finished.
+// tempDir, if set, is removed with it.
+type sessionBody struct {
+	io.ReadCloser
+	session *session.Session
+	tempDir string
+}
+
+func (b sessionBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.session.Close()
+	if b.tempDir != "" {
+		os.RemoveAll(b.tempDir)
+	}
+	return err
+}
@@ -0,0 +1,342 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	dockertypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	buildkitclient "github.com/moby/buildkit/client"
+	_ "github.com/moby/buildkit/client/connhelper/dockercontainer"
+	_ "github.com/moby/buildkit/client/connhelper/kubepod"
+	"github.com/moby/buildkit/session"
+	"github.com/moby/buildkit/session/secrets/secretsprovider"
+	"github.com/moby/buildkit/util/entitlements"
+	"github.com/tonistiigi/fsutil"
+)
+
+// buildxBuilder is a builder instance created with docker buildx create, as
+// stored by buildx below the docker CLI config directory.
+type buildxBuilder struct {
+	Name   string
+	Driver string
+	Nodes  []buildxNode
+}
+
+type buildxNode struct {
+	Name       string
+	Endpoint   string
+	DriverOpts map[string]string
+}
+
+// loadBuildxBuilder reads the buildx builder instance called name.
+func loadBuildxBuilder(configDir string, name string) (buildxBuilder, error) {
+	builder := buildxBuilder{}
+
+	content, err := os.ReadFile(filepath.Join(configDir, "buildx", "instances", name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return builder, fmt.Errorf("buildx builder %q does not exist", name)
+		}
+		return builder, err
+	}
+
+	if err := json.Unmarshal(content, &builder); err != nil {
+		return builder, fmt.Errorf("unable to parse buildx builder %q: %w", name, err)
+	}
+	if len(builder.Nodes) == 0 {
+		return builder, fmt.Errorf("buildx builder %q has no nodes", name)
+	}
+
+	return builder, nil
+}
+
+// buildKitAddress returns the address of the BuildKit daemon of the first
+// node of builder, in the form accepted by the BuildKit client. An empty
+// address is returned for the docker driver, whose builder is the BuildKit
+// embedded in the Docker daemon.
+func buildKitAddress(ctx context.Context, builder buildxBuilder) (string, error) {
+	node := builder.Nodes[0]
+
+	switch builder.Driver {
+	case "docker":
+		return "", nil
+	case "docker-container":
+		// buildx names the container running buildkitd after the node
+		return "docker-container://buildx_buildkit_" + node.Name, nil
+	case "remote":
+		return node.Endpoint, nil
+	case "kubernetes":
+		namespace := node.DriverOpts["namespace"]
+		if namespace == "" {
+			namespace = "default"
+		}
+
+		// buildx runs buildkitd in a deployment named after the node, whose
+		// pods are labelled with app=<node>
+		output, err := exec.CommandContext(ctx, "kubectl", "get", "pods",
+			"--namespace", namespace,
+			"--selector", "app="+node.Name,
+			"--field-selector", "status.phase=Running",
+			"--output", "jsonpath={.items[0].metadata.name}",
+		).Output()
+		if err != nil {
+			return "", fmt.Errorf("unable to find a running pod of buildx builder %q: %w", builder.Name, err)
+		}
+
+		pod := strings.TrimSpace(string(output))
+		if pod == "" {
+			return "", fmt.Errorf("buildx builder %q has no running pods", builder.Name)
+		}
+
+		return "kube-pod://" + pod + "?namespace=" + url.QueryEscape(namespace), nil
+	default:
+		return "", fmt.Errorf("driver %q of buildx builder %q is not supported", builder.Driver, builder.Name)
+	}
+}
+
+// buildKitBuild builds the image with the BuildKit daemon at address and
+// loads it into the Docker daemon, the same way docker buildx build --load
+// does, leaving the paths matched by excludes out of the context. clientOpts
+// configure the connection, e.g. its TLS credentials. The progress of the
+// build is streamed in the body of the returned response as JSON messages,
+// like the ones of the /build endpoint of the daemon, so that they can be
+// read with parseDockerDaemonJsonMessages. The cache of the build is exported
+// with cacheExports, e.g. to a registry.
+func buildKitBuild(r *imageResource, ctx context.Context, address string, dir string, dockerFile string, dockerFileContent string, excludes []string, buildOptions dockertypes.ImageBuildOptions, cacheExports []buildkitclient.CacheOptionsEntry, secrets map[string][]byte, clientOpts ...buildkitclient.ClientOpt) (dockertypes.ImageBuildResponse, error) {
+	buildKit, err := buildkitclient.New(ctx, address, clientOpts...)
+	if err != nil {
+		return dockertypes.ImageBuildResponse{}, fmt.Errorf("unable to connect to BuildKit at %s: %w", address, err)
+	}
+
+	authProvider, err := buildAuthProvider(r.registryAuths, r.configDir)
+	if err != nil {
+		buildKit.Close()
+		return dockertypes.ImageBuildResponse{}, err
+	}
+
+	solveOpt := buildkitclient.SolveOpt{
+		Frontend:      "dockerfile.v0",
+		FrontendAttrs: dockerfileFrontendAttrs(dockerFile, buildOptions),
+		LocalMounts:   map[string]fsutil.FS{},
+		Session:       []session.Attachable{authProvider, secretsprovider.FromMap(secrets)},
+	}
+
+	if buildOptions.NetworkMode == "host" {
+		solveOpt.AllowedEntitlements = append(solveOpt.AllowedEntitlements, entitlements.EntitlementNetworkHost)
+	}
+
+	// Unlike the BuildKit of the daemon, a standalone BuildKit exports the
+	// cache with the exporters of the solve request rather than a build
+	// argument, and also to registries and local directories
+	solveOpt.CacheExports = append(solveOpt.CacheExports, cacheExports...)
+
+	for _, cacheFrom := range buildOptions.CacheFrom {
+		solveOpt.CacheImports = append(solveOpt.CacheImports, buildkitclient.CacheOptionsEntry{
+			Type:  "registry",
+			Attrs: map[string]string{"ref": cacheFrom},
+		})
+	}
+
+	var dockerFileDir string
+	if buildOptions.RemoteContext == "" {
+		dirFS, err := fsutil.NewFS(dir)
+		if err != nil {
+			buildKit.Close()
+			return dockertypes.ImageBuildResponse{}, err
+		}
+		contextFS, err := excludeFromContext(dirFS, excludes)
+		if err != nil {
+			buildKit.Close()
+			return dockertypes.ImageBuildResponse{}, err
+		}
+		solveOpt.LocalMounts["context"] = contextFS
+		solveOpt.LocalMounts["dockerfile"] = dirFS
+
+		// dockerfile_content is sent from a directory of its own
+		if dockerFileContent != "" {
+			dockerFileDir, err = writeDockerfileContent(dockerFileContent)
+			if err == nil {
+				solveOpt.LocalMounts["dockerfile"], err = fsutil.NewFS(dockerFileDir)
+			}
+			if err != nil {
+				buildKit.Close()
+				os.RemoveAll(dockerFileDir)
+				return dockertypes.ImageBuildResponse{}, err
+			}
+			solveOpt.FrontendAttrs["filename"] = "Dockerfile"
+		}
+	}
+
+	// Loads the image into the Docker daemon as it is exported, unless an
+	// output is set
+	loaded := make(chan error, 1)
+	solveOpt.Exports = []buildkitclient.ExportEntry{
+		{
+			Type:  buildkitclient.ExporterDocker,
+			Attrs: map[string]string{"name": strings.Join(buildOptions.Tags, ",")},
+			Output: func(map[string]string) (io.WriteCloser, error) {
+				reader, writer := io.Pipe()
+				go func() {
+					loadResponse, err := r.client.ImageLoad(ctx, reader, true)
+					if err == nil {
+						_, err = io.Copy(io.Discard, loadResponse.Body)
+						loadResponse.Body.Close()
+					}
+					reader.CloseWithError(err)
+					loaded <- err
+				}()
+				return writer, nil
+			},
+		},
+	}
+
+	for _, output := range buildOptions.Outputs {
+		exportEntry := buildkitclient.ExportEntry{Type: output.Type}
+		dest := output.Attrs["dest"]
+		if output.Type == buildkitclient.ExporterLocal {
+			exportEntry.OutputDir = dest
+		} else {
+			exportEntry.Attrs = map[string]string{"name": strings.Join(buildOptions.Tags, ",")}
+			exportEntry.Output = func(map[string]string) (io.WriteCloser, error) {
+				return os.Create(dest)
+			}
+		}
+
+		solveOpt.Exports = []buildkitclient.ExportEntry{exportEntry}
+		loaded <- nil
+	}
+
+	body, bodyWriter := io.Pipe()
+	go func() {
+		defer buildKit.Close()
+		if dockerFileDir != "" {
+			defer os.RemoveAll(dockerFileDir)
+		}
+
+		encoder := json.NewEncoder(bodyWriter)
+		statusChan := make(chan *buildkitclient.SolveStatus)
+		traced := make(chan struct{})
+		go func() {
+			defer close(traced)
+			for status := range statusChan {
+				for _, statusResponse := range status.Marshal() {
+					encodedStatus, err := statusResponse.Marshal()
+					if err != nil {
+						continue
+					}
+					aux, _ := json.Marshal(encodedStatus)
+					auxMessage := json.RawMessage(aux)
+					encoder.Encode(jsonmessage.JSONMessage{ID: buildKitTraceID, Aux: &auxMessage})
+				}
+			}
+		}()
+
+		solveResponse, err := buildKit.Solve(ctx, nil, solveOpt, statusChan)
+		<-traced
+		if err == nil {
+			err = <-loaded
+		}
+		if err != nil {
+			encoder.Encode(jsonmessage.JSONMessage{Error: &jsonmessage.JSONError{Message: err.Error()}})
+			bodyWriter.Close()
+			return
+		}
+
+		tflog.Debug(ctx, "BuildKit build finished", map[string]any{"exporter_response": solveResponse.ExporterResponse})
+
+		result, _ := json.Marshal(dockertypes.BuildResult{ID: solveResponse.ExporterResponse["containerimage.config.digest"]})
+		resultMessage := json.RawMessage(result)
+		encoder.Encode(jsonmessage.JSONMessage{Aux: &resultMessage})
+		bodyWriter.Close()
+	}()
+
+	return dockertypes.ImageBuildResponse{Body: body}, nil
+}
+
+// buildKitClientOpts returns the options of the connection to the BuildKit
+// daemon at address, as set by the buildkit_tls block of docker_image, which
+// ValidateConfig only accepts with buildkit_host.
+func buildKitClientOpts(address string, tls *buildKitTLSModel) ([]buildkitclient.ClientOpt, error) {
+	if tls == nil {
+		return nil, nil
+	}
+
+	serverName := tls.ServerName.ValueString()
+	if serverName == "" {
+		addressURL, err := url.Parse(address)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse buildkit_host: %w", err)
+		}
+		serverName = addressURL.Hostname()
+	}
+
+	opts := []buildkitclient.ClientOpt{}
+	if tls.CACert.ValueString() != "" {
+		opts = append(opts, buildkitclient.WithServerConfig(serverName, tls.CACert.ValueString()))
+	} else {
+		opts = append(opts, buildkitclient.WithServerConfigSystem(serverName))
+	}
+	if tls.Cert.ValueString() != "" {
+		opts = append(opts, buildkitclient.WithCredentials(tls.Cert.ValueString(), tls.Key.ValueString()))
+	}
+
+	return opts, nil
+}
+
+// dockerfileFrontendAttrs translates the build options into the attributes of
+// the Dockerfile frontend of BuildKit.
+func dockerfileFrontendAttrs(dockerFile string, buildOptions dockertypes.ImageBuildOptions) map[string]string {
+	attrs := map[string]string{
+		"filename": filepath.ToSlash(dockerFile),
+	}
+
+	if buildOptions.RemoteContext != "" {
+		attrs["context"] = buildOptions.RemoteContext
+	}
+	if buildOptions.Target != "" {
+		attrs["target"] = buildOptions.Target
+	}
+	if buildOptions.Platform != "" {
+		attrs["platform"] = buildOptions.Platform
+	}
+	if buildOptions.NoCache {
+		attrs["no-cache"] = ""
+	}
+	if buildOptions.PullParent {
+		attrs["image-resolve-mode"] = "pull"
+	}
+	if buildOptions.NetworkMode != "" {
+		attrs["force-network-mode"] = buildOptions.NetworkMode
+	}
+	if len(buildOptions.ExtraHosts) > 0 {
+		// BuildKit expects host=ip rather than host:ip
+		hosts := []string{}
+		for _, extraHost := range buildOptions.ExtraHosts {
+			host, ip, found := strings.Cut(extraHost, ":")
+			if found {
+				extraHost = host + "=" + ip
+			}
+			hosts = append(hosts, extraHost)
+		}
+		attrs["add-hosts"] = strings.Join(hosts, ",")
+	}
+	for key, value := range buildOptions.Labels {
+		attrs["label:"+key] = value
+	}
+	for key, value := range buildOptions.BuildArgs {
+		if value != nil {
+			attrs["build-arg:"+key] = *value
+		}
+	}
+
+	return attrs
+}
@@ -0,0 +1,260 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	dockertypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/boolplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/int64planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/mapplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+// Ensure the implementation satisfies the expected interfaces.
+var (
+	_ resource.Resource                   = &buildCachePruneResource{}
+	_ resource.ResourceWithConfigure      = &buildCachePruneResource{}
+	_ resource.ResourceWithValidateConfig = &buildCachePruneResource{}
+)
+
+// BuildKit cache record types other than "exec.cachemount". Pruning these one
+// by one leaves RUN --mount=type=cache caches untouched, as the daemon only
+// supports equality filters.
+var buildCacheTypesExceptCacheMounts = []string{
+	"regular",
+	"internal",
+	"frontend",
+	"source.local",
+	"source.git.checkout",
+}
+
+// NewBuildCachePruneResource is a helper function to simplify the provider implementation.
+func NewBuildCachePruneResource() resource.Resource {
+	return &buildCachePruneResource{}
+}
+
+// buildCachePruneResource is the resource implementation.
+type buildCachePruneResource struct {
+	client *client.Client
+}
+
+// Metadata returns the resource type name.
+func (r *buildCachePruneResource) Metadata(_ context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_build_cache_prune"
+}
+
+type buildCachePruneResourceModel struct {
+	ID              types.String `tfsdk:"id"`
+	PruneOn         types.String `tfsdk:"prune_on"`
+	All             types.Bool   `tfsdk:"all"`
+	KeepStorage     types.Int64  `tfsdk:"keep_storage"`
+	Filters         types.Map    `tfsdk:"filters"`
+	KeepCacheMounts types.Bool   `tfsdk:"keep_cache_mounts"`
+	SpaceReclaimed  types.Int64  `tfsdk:"space_reclaimed"`
+	CachesDeleted   types.Int64  `tfsdk:"caches_deleted"`
+}
+
+// Schema defines the schema for the resource.
+func (r *buildCachePruneResource) Schema(_ context.Context, _ resource.SchemaRequest, resp *resource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		Description: "Prunes the build cache of the daemon, like docker builder prune, when created and whenever prune_on changes. Destroying it does not change the build cache.",
+		Attributes: map[string]schema.Attribute{
+			"id": schema.StringAttribute{
+				Description: "Timestamp of the prune.",
+				Computed:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"prune_on": schema.StringAttribute{
+				Description: "Prunes the build cache if this value is updated.",
+				Optional:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"all": schema.BoolAttribute{
+				Description: "Remove all unused build cache, not just dangling records.",
+				Optional:    true,
+				PlanModifiers: []planmodifier.Bool{
+					boolplanmodifier.RequiresReplace(),
+				},
+			},
+			"keep_storage": schema.Int64Attribute{
+				Description: "Amount of disk space in bytes to keep for the build cache. Cannot be used with keep_cache_mounts.",
+				Optional:    true,
+				PlanModifiers: []planmodifier.Int64{
+					int64planmodifier.RequiresReplace(),
+				},
+			},
+			"filters": schema.MapAttribute{
+				Description: "Filters to apply when pruning, e.g. until = \"24h\" or type = \"regular\". See https://docs.docker.com/reference/cli/docker/builder/prune/#filter",
+				ElementType: types.StringType,
+				Optional:    true,
+				PlanModifiers: []planmodifier.Map{
+					mapplanmodifier.RequiresReplace(),
+				},
+			},
+			"keep_cache_mounts": schema.BoolAttribute{
+				Description: "Persist RUN --mount=type=cache caches so they survive the prune.",
+				Optional:    true,
+				PlanModifiers: []planmodifier.Bool{
+					boolplanmodifier.RequiresReplace(),
+				},
+			},
+			"space_reclaimed": schema.Int64Attribute{
+				Description: "Disk space in bytes reclaimed by the prune.",
+				Computed:    true,
+			},
+			"caches_deleted": schema.Int64Attribute{
+				Description: "Number of build cache records removed by the prune.",
+				Computed:    true,
+			},
+		},
+	}
+}
+
+// ValidateConfig rejects the attributes that cannot be used with
+// keep_cache_mounts, which prunes each type of build cache record separately.
+func (r *buildCachePruneResource) ValidateConfig(ctx context.Context, req resource.ValidateConfigRequest, resp *resource.ValidateConfigResponse) {
+	var keepCacheMounts types.Bool
+	var keepStorage types.Int64
+	var planFilters types.Map
+	resp.Diagnostics.Append(req.Config.GetAttribute(ctx, path.Root("keep_cache_mounts"), &keepCacheMounts)...)
+	resp.Diagnostics.Append(req.Config.GetAttribute(ctx, path.Root("keep_storage"), &keepStorage)...)
+	resp.Diagnostics.Append(req.Config.GetAttribute(ctx, path.Root("filters"), &planFilters)...)
+	if resp.Diagnostics.HasError() || !keepCacheMounts.ValueBool() {
+		return
+	}
+
+	if _, ok := planFilters.Elements()["type"]; ok {
+		resp.Diagnostics.AddAttributeError(
+			path.Root("filters"),
+			"Invalid build cache prune configuration",
+			"keep_cache_mounts cannot be combined with a \"type\" filter.",
+		)
+	}
+
+	// Each prune would keep keep_storage bytes of its own type
+	if !keepStorage.IsNull() && !keepStorage.IsUnknown() {
+		resp.Diagnostics.AddAttributeError(
+			path.Root("keep_storage"),
+			"Invalid build cache prune configuration",
+			"keep_storage cannot be combined with keep_cache_mounts.",
+		)
+	}
+}
+
+// Create creates the resource and sets the initial Terraform state.
+func (r *buildCachePruneResource) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
+	var plan buildCachePruneResourceModel
+	diags := req.Plan.Get(ctx, &plan)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	planFilters := map[string]string{}
+	diags = plan.Filters.ElementsAs(ctx, &planFilters, false)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	pruneFilters := filters.NewArgs()
+	for key, value := range planFilters {
+		pruneFilters.Add(key, value)
+	}
+
+	// Without keep_cache_mounts a single prune covers every record type
+	pruneTypes := []string{""}
+	if plan.KeepCacheMounts.ValueBool() {
+		pruneTypes = buildCacheTypesExceptCacheMounts
+	}
+
+	var spaceReclaimed uint64
+	var cachesDeleted int
+	for _, pruneType := range pruneTypes {
+		typeFilters := pruneFilters.Clone()
+		if pruneType != "" {
+			typeFilters.Add("type", pruneType)
+		}
+
+		report, err := r.client.BuildCachePrune(ctx, dockertypes.BuildCachePruneOptions{
+			All:         plan.All.ValueBool(),
+			KeepStorage: plan.KeepStorage.ValueInt64(),
+			Filters:     typeFilters,
+		})
+		if err != nil {
+			tflog.Debug(ctx, "Unable to prune build cache")
+			tflog.Debug(ctx, err.Error())
+
+			resp.Diagnostics.AddError(
+				"Unable to prune build cache",
+				"Could not prune build cache, unexpected error: "+err.Error(),
+			)
+			return
+		}
+
+		spaceReclaimed += report.SpaceReclaimed
+		cachesDeleted += len(report.CachesDeleted)
+	}
+
+	plan.ID = types.StringValue(time.Now().UTC().Format(time.RFC3339))
+	plan.SpaceReclaimed = types.Int64Value(int64(spaceReclaimed))
+	plan.CachesDeleted = types.Int64Value(int64(cachesDeleted))
+
+	// Set state to fully populated data
+	diags = resp.State.Set(ctx, &plan)
+
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+}
+
+// Read refreshes the Terraform state with the latest data.
+func (r *buildCachePruneResource) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
+}
+
+// Update updates the resource and sets the updated Terraform state on success.
+func (r *buildCachePruneResource) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
+}
+
+// Delete deletes the resource and removes the Terraform state on success.
+func (r *buildCachePruneResource) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
+}
+
+// Configure adds the provider configured client to the resource.
+func (r *buildCachePruneResource) Configure(_ context.Context, req resource.ConfigureRequest, resp *resource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+
+	providerData, ok := req.ProviderData.(*dockerProviderData)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Resource Configure Type",
+			fmt.Sprintf("Expected *dockerProviderData, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+		)
+
+		return
+	}
+
+	providerData.requireDaemon("docker_build_cache_prune", &resp.Diagnostics)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	r.client = providerData.client
+}
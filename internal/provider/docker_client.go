@@ -0,0 +1,379 @@
+package provider
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/client"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	"golang.org/x/net/http/httpproxy"
+)
+
+// Matches the API version prefix, e.g. "/v1.45", of Engine API paths.
+var apiVersionPrefix = regexp.MustCompile(`^/v[0-9.]+`)
+
+// auditLogEntry is a single line of the audit log.
+type auditLogEntry struct {
+	Time      string `json:"time"`
+	Operation string `json:"operation"`
+	Target    string `json:"target"`
+	Outcome   string `json:"outcome"`
+}
+
+// auditLog appends entries to the audit log file at path. The file is only
+// open while an entry is written, so that configuring the provider again, as
+// Terraform does for every operation, does not leak file handles.
+type auditLog struct {
+	path string
+	mu   sync.Mutex
+}
+
+// newAuditLog returns the audit log at path, checking that it can be written.
+func newAuditLog(path string) (*auditLog, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	return &auditLog{path: path}, file.Close()
+}
+
+func (l *auditLog) write(entry auditLogEntry) {
+	line, _ := json.Marshal(entry)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	file, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	file.Write(append(line, '\n'))
+}
+
+// auditTransport records every request made through it to an audit log.
+type auditTransport struct {
+	next http.RoundTripper
+	log  *auditLog
+	// registry records the host of each request along with its path, for
+	// requests to registries rather than to the daemon
+	registry bool
+}
+
+func (t *auditTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+
+	outcome := ""
+	if err != nil {
+		outcome = err.Error()
+	} else {
+		outcome = resp.Status
+	}
+
+	target := apiVersionPrefix.ReplaceAllString(req.URL.Path, "")
+	if t.registry {
+		target = req.URL.Host + req.URL.Path
+	}
+
+	t.log.write(auditLogEntry{
+		Time:      time.Now().UTC().Format(time.RFC3339),
+		Operation: req.Method,
+		Target:    target,
+		Outcome:   outcome,
+	})
+
+	return resp, err
+}
+
+// userAgentTransport sets the User-Agent of every request made through it.
+type userAgentTransport struct {
+	next      http.RoundTripper
+	userAgent string
+}
+
+func (t *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Round trippers must not modify the request they are given
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", t.userAgent)
+
+	return t.next.RoundTrip(req)
+}
+
+// debugTransport logs every request made through it, with the response status
+// and duration, to the Terraform log.
+type debugTransport struct {
+	next http.RoundTripper
+}
+
+func (t *debugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+
+	fields := map[string]any{
+		"method":      req.Method,
+		"path":        apiVersionPrefix.ReplaceAllString(req.URL.Path, ""),
+		"duration_ms": time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		fields["error"] = err.Error()
+	} else {
+		fields["status"] = resp.StatusCode
+	}
+
+	// Requests made by resources carry the Terraform logger in their context
+	tflog.Debug(req.Context(), "Docker Engine API call", fields)
+
+	return resp, err
+}
+
+// withDebugLogging logs every Engine API call made by the client through
+// tflog.
+func withDebugLogging() client.Opt {
+	return func(c *client.Client) error {
+		httpClient := c.HTTPClient()
+		httpClient.Transport = &debugTransport{
+			next: httpClient.Transport,
+		}
+
+		return client.WithHTTPClient(httpClient)(c)
+	}
+}
+
+// withAuditLog appends every Engine API operation made by the client to log.
+func withAuditLog(log *auditLog) client.Opt {
+	return func(c *client.Client) error {
+		httpClient := c.HTTPClient()
+		httpClient.Transport = &auditTransport{
+			next: httpClient.Transport,
+			log:  log,
+		}
+
+		return client.WithHTTPClient(httpClient)(c)
+	}
+}
+
+// tlsMaterial holds the PEM-encoded material used to talk to a TLS-protected
+// Docker daemon.
+type tlsMaterial struct {
+	ca   []byte
+	cert []byte
+	key  []byte
+}
+
+func (m tlsMaterial) isSet() bool {
+	return len(m.ca) > 0 || len(m.cert) > 0 || len(m.key) > 0
+}
+
+// loadTLSMaterial reads ca.pem, cert.pem and key.pem from certPath. Missing
+// files are left empty.
+func loadTLSMaterial(certPath string) (tlsMaterial, error) {
+	material := tlsMaterial{}
+	if certPath == "" {
+		return material, nil
+	}
+
+	files := map[string]*[]byte{
+		"ca.pem":   &material.ca,
+		"cert.pem": &material.cert,
+		"key.pem":  &material.key,
+	}
+	for fileName, content := range files {
+		readFile, err := os.ReadFile(filepath.Join(certPath, fileName))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return material, err
+		}
+		*content = readFile
+	}
+
+	return material, nil
+}
+
+// withTLSMaterial configures the client transport to use TLS with the given
+// material. It has to be applied after the host is set.
+func withTLSMaterial(material tlsMaterial, verify bool) client.Opt {
+	return func(c *client.Client) error {
+		tlsConfig := &tls.Config{
+			MinVersion:         tls.VersionTLS12,
+			InsecureSkipVerify: !verify,
+		}
+
+		if len(material.ca) > 0 {
+			certPool := x509.NewCertPool()
+			if !certPool.AppendCertsFromPEM(material.ca) {
+				return fmt.Errorf("unable to parse CA certificate")
+			}
+			tlsConfig.RootCAs = certPool
+		}
+
+		if len(material.cert) > 0 || len(material.key) > 0 {
+			certificate, err := tls.X509KeyPair(material.cert, material.key)
+			if err != nil {
+				return fmt.Errorf("unable to load client certificate: %w", err)
+			}
+			tlsConfig.Certificates = []tls.Certificate{certificate}
+		}
+
+		transport, ok := c.HTTPClient().Transport.(*http.Transport)
+		if !ok {
+			return fmt.Errorf("cannot apply TLS configuration to transport: %T", c.HTTPClient().Transport)
+		}
+		transport.TLSClientConfig = tlsConfig
+
+		return client.WithScheme("https")(c)
+	}
+}
+
+// connectionSettings tunes the connections of the client to the Docker daemon.
+type connectionSettings struct {
+	connectTimeout  time.Duration
+	requestTimeout  time.Duration
+	keepAlive       time.Duration
+	idleConnTimeout time.Duration
+}
+
+// withConnectionSettings applies settings to the client transport. It has to
+// be applied after the host is set.
+func withConnectionSettings(settings connectionSettings) client.Opt {
+	return func(c *client.Client) error {
+		transport, ok := c.HTTPClient().Transport.(*http.Transport)
+		if !ok {
+			return fmt.Errorf("cannot apply connection settings to transport: %T", c.HTTPClient().Transport)
+		}
+
+		if strings.HasPrefix(c.DaemonHost(), "tcp://") {
+			transport.DialContext = (&net.Dialer{
+				Timeout:   settings.connectTimeout,
+				KeepAlive: settings.keepAlive,
+			}).DialContext
+		} else if transport.DialContext != nil && settings.connectTimeout > 0 {
+			// Sockets, named pipes and ssh use their own dialers
+			dial := transport.DialContext
+			transport.DialContext = func(ctx context.Context, network string, addr string) (net.Conn, error) {
+				ctx, cancel := context.WithTimeout(ctx, settings.connectTimeout)
+				defer cancel()
+				return dial(ctx, network, addr)
+			}
+		}
+
+		transport.IdleConnTimeout = settings.idleConnTimeout
+
+		return client.WithTimeout(settings.requestTimeout)(c)
+	}
+}
+
+// withProxy routes the connections of the client to the Docker daemon through
+// the proxies in proxyConfig.
+func withProxy(proxyConfig *httpproxy.Config) client.Opt {
+	return func(c *client.Client) error {
+		transport, ok := c.HTTPClient().Transport.(*http.Transport)
+		if !ok {
+			return fmt.Errorf("cannot apply proxy configuration to transport: %T", c.HTTPClient().Transport)
+		}
+
+		proxyFunc := proxyConfig.ProxyFunc()
+		transport.Proxy = func(req *http.Request) (*url.URL, error) {
+			return proxyFunc(req.URL)
+		}
+
+		return nil
+	}
+}
+
+// dockerContextEndpoint is the docker endpoint of a context created with
+// docker context create.
+type dockerContextEndpoint struct {
+	Host          string
+	SkipTLSVerify bool
+	TLS           tlsMaterial
+}
+
+// dockerConfigDir returns the directory holding the docker CLI configuration:
+// configPath if set, else DOCKER_CONFIG, else ~/.docker like the docker CLI.
+func dockerConfigDir(configPath types.String) (string, error) {
+	if configDir := valueOrEnv(configPath, "DOCKER_CONFIG"); configDir != "" {
+		return configDir, nil
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(homeDir, ".docker"), nil
+}
+
+// loadDockerContext reads the docker endpoint of the named context from the
+// context store of the docker CLI. Contexts are stored in directories named
+// after the SHA256 of the context name, below configDir.
+func loadDockerContext(configDir string, name string) (dockerContextEndpoint, error) {
+	endpoint := dockerContextEndpoint{}
+
+	// The default context is the local daemon
+	if name == "default" {
+		return endpoint, nil
+	}
+
+	nameHash := sha256.Sum256([]byte(name))
+	contextID := hex.EncodeToString(nameHash[:])
+
+	meta, err := os.ReadFile(filepath.Join(configDir, "contexts", "meta", contextID, "meta.json"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return endpoint, fmt.Errorf("context %q does not exist", name)
+		}
+		return endpoint, err
+	}
+
+	var contextMeta struct {
+		Endpoints map[string]dockerContextEndpoint
+	}
+	if err := json.Unmarshal(meta, &contextMeta); err != nil {
+		return endpoint, err
+	}
+
+	endpoint, ok := contextMeta.Endpoints["docker"]
+	if !ok {
+		return endpoint, fmt.Errorf("context %q has no docker endpoint", name)
+	}
+
+	endpoint.TLS, err = loadTLSMaterial(filepath.Join(configDir, "contexts", "tls", contextID, "docker"))
+
+	return endpoint, err
+}
+
+// daemonUnreachableDetail describes why the daemon at host could not be
+// reached and how to fix it.
+func daemonUnreachableDetail(host string, err error) string {
+	detail := "Could not connect to the Docker daemon at " + host + ": " + err.Error() + "\n\n"
+
+	switch {
+	case errors.Is(err, os.ErrPermission) || strings.Contains(err.Error(), "permission denied"):
+		detail += "The current user is not allowed to access the Docker socket. Add the user to the docker group, " +
+			"run Terraform as a user with access to the socket or set host to a daemon the user can access."
+	case strings.HasPrefix(host, "ssh://"):
+		detail += "Check that the host can be reached with ssh and that the docker CLI is installed on it."
+	case client.IsErrConnectionFailed(err) || errors.Is(err, os.ErrNotExist) || strings.Contains(err.Error(), "no such file or directory"):
+		detail += "Check that the Docker daemon is running and that host, or the DOCKER_HOST environment variable, points to it."
+	default:
+		detail += "Check that host and the TLS settings of the provider match the Docker daemon."
+	}
+
+	return detail
+}
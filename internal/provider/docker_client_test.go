@@ -0,0 +1,50 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types/registry"
+)
+
+// TestRegistryTransports checks that the requests of registry clients carry
+// the User-Agent of the provider and are written to the audit log.
+func TestRegistryTransports(t *testing.T) {
+
+	userAgent := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent = r.Header.Get("User-Agent")
+		w.Header().Set("Docker-Content-Digest", "sha256:6a5e")
+	}))
+	defer server.Close()
+
+	auditLogFile := filepath.Join(t.TempDir(), "audit.log")
+	audit, err := newAuditLog(auditLogFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transports := newRegistryTransports("terraform-provider-docker/test ci", audit)
+
+	address := strings.TrimPrefix(server.URL, "http://")
+	registryClient := newRegistryClient(address, registry.AuthConfig{}, true, transports)
+	if _, err := registryClient.manifestDigest(context.Background(), "team/app", "v1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if userAgent != "terraform-provider-docker/test ci" {
+		t.Fatalf("User-Agent is incorrect! Expected terraform-provider-docker/test ci but found %q.", userAgent)
+	}
+
+	auditLog, err := os.ReadFile(auditLogFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(auditLog), `"target":"`+address+`/v2/team/app/manifests/v1"`) {
+		t.Fatalf("Audit log does not record the registry request: %s", auditLog)
+	}
+}
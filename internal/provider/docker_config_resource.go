@@ -0,0 +1,269 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+// goTemplateDriver is the only templating driver of Swarm configs.
+const goTemplateDriver = "golang"
+
+// Ensure the implementation satisfies the expected interfaces.
+var (
+	_ resource.Resource              = &configResource{}
+	_ resource.ResourceWithConfigure = &configResource{}
+)
+
+// NewConfigResource is a helper function to simplify the provider implementation.
+func NewConfigResource() resource.Resource {
+	return &configResource{}
+}
+
+// configResource is the resource implementation.
+type configResource struct {
+	client *client.Client
+	retry  retryConfig
+}
+
+// Metadata returns the resource type name.
+func (r *configResource) Metadata(_ context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_config"
+}
+
+type configResourceModel struct {
+	ID             types.String `tfsdk:"id"`
+	Name           types.String `tfsdk:"name"`
+	Data           types.String `tfsdk:"data"`
+	Labels         types.Map    `tfsdk:"labels"`
+	TemplateDriver types.String `tfsdk:"template_driver"`
+}
+
+// Schema defines the schema for the resource.
+func (r *configResource) Schema(_ context.Context, _ resource.SchemaRequest, resp *resource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		Description: "Creates a Swarm config, like docker config create, that services mount as a file. Requires a daemon that is a Swarm manager. Configs cannot be changed once created, so changing data creates the config again, which fails while services use it: to roll a new version out, derive name from the data, e.g. \"app-${sha256(data)}\", with create_before_destroy.",
+		Attributes: map[string]schema.Attribute{
+			"id": schema.StringAttribute{
+				Description: "ID of the config.",
+				Computed:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"name": schema.StringAttribute{
+				Description: "Name of the config.",
+				Required:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"data": schema.StringAttribute{
+				Description: "Content of the config, at most 1000KB.",
+				Required:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"labels": schema.MapAttribute{
+				Description: "Labels of the config. Labels are updated in place.",
+				ElementType: types.StringType,
+				Optional:    true,
+			},
+			"template_driver": schema.StringAttribute{
+				Description: "Templating driver that renders data for each task of a service that mounts the config, e.g. with {{ .Service.Name }}. Only \"" + goTemplateDriver + "\" is supported. Unset, data is mounted as is.",
+				Optional:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+				Validators: []validator.String{
+					templateDriverValidator{},
+				},
+			},
+		},
+	}
+}
+
+// Create creates the resource and sets the initial Terraform state.
+func (r *configResource) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
+	var plan configResourceModel
+	diags := req.Plan.Get(ctx, &plan)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	labels := map[string]string{}
+	resp.Diagnostics.Append(plan.Labels.ElementsAs(ctx, &labels, false)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	configSpec := swarm.ConfigSpec{
+		Annotations: swarm.Annotations{
+			Name:   plan.Name.ValueString(),
+			Labels: labels,
+		},
+		Data: []byte(plan.Data.ValueString()),
+	}
+	if plan.TemplateDriver.ValueString() != "" {
+		configSpec.Templating = &swarm.Driver{Name: plan.TemplateDriver.ValueString()}
+	}
+
+	createResponse, err := r.client.ConfigCreate(ctx, configSpec)
+	if err != nil {
+		tflog.Debug(ctx, "Unable to create docker config")
+		tflog.Debug(ctx, err.Error())
+
+		resp.Diagnostics.AddError(
+			"Unable to create docker config",
+			"Could not create docker config "+plan.Name.ValueString()+", unexpected error: "+err.Error(),
+		)
+		return
+	}
+
+	plan.ID = types.StringValue(createResponse.ID)
+
+	// Set state to fully populated data
+	diags = resp.State.Set(ctx, &plan)
+	resp.Diagnostics.Append(diags...)
+}
+
+// Read refreshes the Terraform state with the latest data.
+// The config is created again if it was removed outside of Terraform.
+func (r *configResource) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
+	var state configResourceModel
+	diags := req.State.Get(ctx, &state)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	var config swarm.Config
+	err := retryOnTransientError(ctx, r.retry, "config inspect", func() error {
+		var err error
+		config, _, err = r.client.ConfigInspectWithRaw(ctx, state.ID.ValueString())
+		return err
+	})
+	if errdefs.IsNotFound(err) {
+		resp.State.RemoveResource(ctx)
+		return
+	}
+	if err != nil {
+		resp.Diagnostics.AddError(
+			"Unable to read docker config",
+			"Could not read docker config "+state.Name.ValueString()+", unexpected error: "+err.Error(),
+		)
+		return
+	}
+
+	state.Name = types.StringValue(config.Spec.Name)
+	state.Data = types.StringValue(string(config.Spec.Data))
+	if !state.Labels.IsNull() || len(config.Spec.Labels) > 0 {
+		state.Labels, diags = types.MapValueFrom(ctx, types.StringType, config.Spec.Labels)
+		resp.Diagnostics.Append(diags...)
+	}
+
+	diags = resp.State.Set(ctx, &state)
+	resp.Diagnostics.Append(diags...)
+}
+
+// Update updates the resource and sets the updated Terraform state on success.
+// Only the labels of a config can be changed.
+func (r *configResource) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
+	var plan configResourceModel
+	diags := req.Plan.Get(ctx, &plan)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	labels := map[string]string{}
+	resp.Diagnostics.Append(plan.Labels.ElementsAs(ctx, &labels, false)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	// Updates are rejected unless they are based on the current version
+	config, _, err := r.client.ConfigInspectWithRaw(ctx, plan.ID.ValueString())
+	if err != nil {
+		resp.Diagnostics.AddError(
+			"Unable to read docker config",
+			"Could not read docker config "+plan.Name.ValueString()+", unexpected error: "+err.Error(),
+		)
+		return
+	}
+
+	config.Spec.Labels = labels
+	if err := r.client.ConfigUpdate(ctx, config.ID, config.Version, config.Spec); err != nil {
+		tflog.Debug(ctx, "Unable to update docker config")
+		tflog.Debug(ctx, err.Error())
+
+		resp.Diagnostics.AddError(
+			"Unable to update docker config",
+			"Could not update labels of docker config "+plan.Name.ValueString()+", unexpected error: "+err.Error(),
+		)
+		return
+	}
+
+	diags = resp.State.Set(ctx, &plan)
+	resp.Diagnostics.Append(diags...)
+}
+
+// Delete deletes the resource and removes the Terraform state on success.
+func (r *configResource) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
+	var state configResourceModel
+	diags := req.State.Get(ctx, &state)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	err := retryOnTransientError(ctx, r.retry, "config remove", func() error {
+		return r.client.ConfigRemove(ctx, state.ID.ValueString())
+	})
+	if err != nil && !errdefs.IsNotFound(err) {
+		tflog.Debug(ctx, "Unable to remove docker config")
+		tflog.Debug(ctx, err.Error())
+
+		resp.Diagnostics.AddError(
+			"Unable to remove docker config",
+			"Could not remove docker config "+state.Name.ValueString()+", unexpected error: "+err.Error(),
+		)
+	}
+}
+
+// Configure adds the provider configured client to the resource.
+func (r *configResource) Configure(_ context.Context, req resource.ConfigureRequest, resp *resource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+
+	providerData, ok := req.ProviderData.(*dockerProviderData)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Resource Configure Type",
+			fmt.Sprintf("Expected *dockerProviderData, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+		)
+
+		return
+	}
+
+	providerData.requireDaemon("docker_config", &resp.Diagnostics)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	r.client = providerData.client
+	r.retry = providerData.retry
+}
@@ -0,0 +1,377 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/distribution/reference"
+	"github.com/docker/docker/api/types/registry"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/mapplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// Ensure the implementation satisfies the expected interfaces.
+var (
+	_ resource.Resource              = &imageCopyResource{}
+	_ resource.ResourceWithConfigure = &imageCopyResource{}
+)
+
+// NewImageCopyResource is a helper function to simplify the provider implementation.
+func NewImageCopyResource() resource.Resource {
+	return &imageCopyResource{}
+}
+
+// imageCopyResource is the resource implementation. It talks to the
+// registries directly, so it needs no Docker daemon.
+type imageCopyResource struct {
+	registryAuths      map[string]registry.AuthConfig
+	insecureRegistries map[string]bool
+	registryTransports *registryTransports
+	configDir          string
+	retry              retryConfig
+}
+
+// Metadata returns the resource type name.
+func (r *imageCopyResource) Metadata(_ context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_image_copy"
+}
+
+type imageCopyResourceModel struct {
+	ID          types.String `tfsdk:"id"`
+	Source      types.String `tfsdk:"source"`
+	Destination types.String `tfsdk:"destination"`
+	Triggers    types.Map    `tfsdk:"triggers"`
+	Digest      types.String `tfsdk:"digest"`
+}
+
+// Schema defines the schema for the resource.
+func (r *imageCopyResource) Schema(_ context.Context, _ resource.SchemaRequest, resp *resource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		Description: "Copies an image, with all of its platforms, from one registry to another without pulling it through the Docker daemon, e.g. to promote an image between environments. Credentials are read from the registry_auth of the provider or from docker login. The copy is left in the destination registry when the resource is destroyed.",
+		Attributes: map[string]schema.Attribute{
+			"id": schema.StringAttribute{
+				Description: "Digest of the copied image.",
+				Computed:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"source": schema.StringAttribute{
+				Description: "Image to copy, by tag or digest, e.g. \"registry.staging.local/app:v1\" or \"registry.staging.local/app@sha256:...\".",
+				Required:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"destination": schema.StringAttribute{
+				Description: "Repository and tag to copy the image to, e.g. \"registry.prod.local/app:v1\".",
+				Required:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"triggers": schema.MapAttribute{
+				Description: "Arbitrary values that copy the image again when they change, e.g. the digest of the source image, so that a moved source tag is copied.",
+				ElementType: types.StringType,
+				Optional:    true,
+				PlanModifiers: []planmodifier.Map{
+					mapplanmodifier.RequiresReplace(),
+				},
+			},
+			"digest": schema.StringAttribute{
+				Description: "Digest of the copied image, the same in both registries. The image is copied again if the destination tag is deleted or points at another digest.",
+				Computed:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+		},
+	}
+}
+
+// Create creates the resource and sets the initial Terraform state.
+func (r *imageCopyResource) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
+	var plan imageCopyResourceModel
+	diags := req.Plan.Get(ctx, &plan)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	sourceReference, err := manifestReference(plan.Source.ValueString())
+	if err != nil {
+		resp.Diagnostics.AddAttributeError(
+			path.Root("source"),
+			"Invalid source",
+			"Could not parse source "+plan.Source.ValueString()+": "+err.Error(),
+		)
+		return
+	}
+	_, destinationTag, err := splitRepoTag(plan.Destination.ValueString())
+	if err != nil {
+		resp.Diagnostics.AddAttributeError(
+			path.Root("destination"),
+			"Invalid destination",
+			"Could not parse destination "+plan.Destination.ValueString()+" as repository:tag: "+err.Error(),
+		)
+		return
+	}
+
+	imageCopy, err := r.newImageCopy(ctx, plan.Source.ValueString(), plan.Destination.ValueString())
+	if err != nil {
+		resp.Diagnostics.AddError(
+			"Unable to copy docker image",
+			"Could not resolve registries of "+plan.Source.ValueString()+" and "+plan.Destination.ValueString()+": "+err.Error(),
+		)
+		return
+	}
+
+	var digest string
+	err = retryOnTransientError(ctx, r.retry, "image copy", func() error {
+		var err error
+		digest, err = imageCopy.copyManifest(ctx, sourceReference, destinationTag)
+		return err
+	})
+	if err != nil {
+		tflog.Debug(ctx, "Unable to copy docker image", map[string]any{"error": err.Error()})
+
+		resp.Diagnostics.AddError(
+			"Unable to copy docker image",
+			"Could not copy "+plan.Source.ValueString()+" to "+plan.Destination.ValueString()+", unexpected error: "+err.Error(),
+		)
+		return
+	}
+
+	tflog.Info(ctx, "Copied docker image", map[string]any{"source": plan.Source.ValueString(), "destination": plan.Destination.ValueString(), "digest": digest})
+
+	plan.ID = types.StringValue(digest)
+	plan.Digest = types.StringValue(digest)
+
+	// Set state to fully populated data
+	diags = resp.State.Set(ctx, &plan)
+
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+}
+
+// Read refreshes the Terraform state with the latest data.
+// The image is copied again if the destination tag was deleted or now points
+// at another digest.
+func (r *imageCopyResource) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
+	var state imageCopyResourceModel
+	diags := req.State.Get(ctx, &state)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	destination := state.Destination.ValueString()
+	_, tag, err := splitRepoTag(destination)
+	if err != nil {
+		return
+	}
+
+	registryAuth, err := registryAuthForImage(ctx, r.registryAuths, r.insecureRegistries, r.configDir, destination)
+	if err == nil {
+		var registryClient *registryClient
+		var repository, digest string
+		registryClient, repository, err = registryClientForImage(destination, registryAuth, r.insecureRegistries, r.registryTransports)
+		if err == nil {
+			digest, err = registryClient.manifestDigest(ctx, repository, tag)
+		}
+		if errors.Is(err, errManifestNotFound) || (err == nil && digest != state.Digest.ValueString()) {
+			tflog.Info(ctx, "Copied image deleted or overwritten in registry", map[string]any{"destination": destination, "digest": state.Digest.ValueString(), "registry_digest": digest})
+			resp.State.RemoveResource(ctx)
+			return
+		}
+	}
+
+	// The registry may be unreachable from where the plan runs
+	if err != nil {
+		tflog.Warn(ctx, "Unable to check copied image in registry", map[string]any{"destination": destination, "error": err.Error()})
+	}
+}
+
+// Update updates the resource and sets the updated Terraform state on success.
+func (r *imageCopyResource) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
+}
+
+// Delete deletes the resource and removes the Terraform state on success.
+func (r *imageCopyResource) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
+}
+
+// Configure adds the provider configured client to the resource.
+func (r *imageCopyResource) Configure(_ context.Context, req resource.ConfigureRequest, resp *resource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+
+	providerData, ok := req.ProviderData.(*dockerProviderData)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Resource Configure Type",
+			fmt.Sprintf("Expected *dockerProviderData, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+		)
+
+		return
+	}
+
+	r.registryAuths = providerData.registryAuths
+	r.insecureRegistries = providerData.insecureRegistries
+	r.registryTransports = providerData.registryTransports
+	r.configDir = providerData.configDir
+	r.retry = providerData.retry
+}
+
+// imageCopy copies manifests and their blobs from a source repository to a
+// destination repository, which may be in another registry.
+type imageCopy struct {
+	source                *registryClient
+	sourceRepository      string
+	destination           *registryClient
+	destinationRepository string
+
+	// Blobs are mounted rather than uploaded within the same registry
+	sameRegistry bool
+}
+
+// newImageCopy returns an imageCopy from the repository of source to the
+// repository of destination, with the credentials of the provider.
+func (r *imageCopyResource) newImageCopy(ctx context.Context, source string, destination string) (*imageCopy, error) {
+	sourceAuth, err := registryAuthForImage(ctx, r.registryAuths, r.insecureRegistries, r.configDir, source)
+	if err != nil {
+		return nil, err
+	}
+	destinationAuth, err := registryAuthForImage(ctx, r.registryAuths, r.insecureRegistries, r.configDir, destination)
+	if err != nil {
+		return nil, err
+	}
+
+	sourceClient, sourceRepository, err := registryClientForImage(source, sourceAuth, r.insecureRegistries, r.registryTransports)
+	if err != nil {
+		return nil, err
+	}
+	destinationClient, destinationRepository, err := registryClientForImage(destination, destinationAuth, r.insecureRegistries, r.registryTransports)
+	if err != nil {
+		return nil, err
+	}
+
+	sourceAddress, _ := registryAddressFromImage(source)
+	destinationAddress, _ := registryAddressFromImage(destination)
+
+	return &imageCopy{
+		source:                sourceClient,
+		sourceRepository:      sourceRepository,
+		destination:           destinationClient,
+		destinationRepository: destinationRepository,
+		sameRegistry:          sourceAddress == destinationAddress,
+	}, nil
+}
+
+// copyManifest copies the manifest that reference points at in the source
+// repository to target in the destination repository, after the manifests of
+// all of its platforms, if it is an index, and all of its blobs. The manifest
+// is copied byte for byte, so that its digest, which is returned, is kept.
+func (c *imageCopy) copyManifest(ctx context.Context, reference string, target string) (string, error) {
+	manifest, mediaType, digest, err := c.source.getManifest(ctx, c.sourceRepository, reference)
+	if err != nil {
+		return "", err
+	}
+
+	// Indexes list manifests, image manifests list a config and layers
+	var content struct {
+		MediaType string               `json:"mediaType"`
+		Manifests []ocispec.Descriptor `json:"manifests"`
+		Config    *ocispec.Descriptor  `json:"config"`
+		Layers    []ocispec.Descriptor `json:"layers"`
+	}
+	if err := json.Unmarshal(manifest, &content); err != nil {
+		return "", fmt.Errorf("unable to parse manifest %s: %w", reference, err)
+	}
+	if mediaType == "" {
+		mediaType = content.MediaType
+	}
+
+	for _, platformManifest := range content.Manifests {
+		childDigest := platformManifest.Digest.String()
+		if _, err := c.copyManifest(ctx, childDigest, childDigest); err != nil {
+			return "", err
+		}
+	}
+
+	blobs := content.Layers
+	if content.Config != nil {
+		blobs = append(blobs, *content.Config)
+	}
+	for _, blob := range blobs {
+		// Foreign layers, e.g. of Windows base images, are not distributed
+		// by the registry
+		if len(blob.URLs) > 0 {
+			continue
+		}
+		if err := c.copyBlob(ctx, blob); err != nil {
+			return "", err
+		}
+	}
+
+	tflog.Debug(ctx, "Copying manifest", map[string]any{"digest": digest, "target": target})
+	if err := c.destination.putManifest(ctx, c.destinationRepository, target, manifest, mediaType); err != nil {
+		return "", err
+	}
+
+	return digest, nil
+}
+
+// copyBlob copies blob to the destination repository, unless it is already
+// there.
+func (c *imageCopy) copyBlob(ctx context.Context, blob ocispec.Descriptor) error {
+	digest := blob.Digest.String()
+	exists, err := c.destination.blobExists(ctx, c.destinationRepository, digest)
+	if err != nil || exists {
+		return err
+	}
+
+	mountFrom := ""
+	if c.sameRegistry {
+		mountFrom = c.sourceRepository
+	}
+	mounted, location, err := c.destination.mountBlob(ctx, c.destinationRepository, digest, mountFrom)
+	if err != nil || mounted {
+		return err
+	}
+
+	tflog.Debug(ctx, "Copying blob", map[string]any{"digest": digest, "size": blob.Size})
+
+	content, err := c.source.getBlob(ctx, c.sourceRepository, digest)
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+
+	return c.destination.uploadBlob(ctx, location, digest, blob.Size, content)
+}
+
+// manifestReference returns the digest of image, if it names one, or else
+// its tag, which defaults to "latest".
+func manifestReference(image string) (string, error) {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return "", err
+	}
+	if canonical, ok := named.(reference.Canonical); ok {
+		return canonical.Digest().String(), nil
+	}
+
+	return reference.TagNameOnly(named).(reference.Tagged).Tag(), nil
+}
@@ -0,0 +1,227 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/docker/docker/api/types/registry"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// testRegistry is an in-memory registry serving the parts of the Registry
+// HTTP API V2 that images are copied with. Manifests and blobs are keyed by
+// repository and reference, e.g. "team/app:v1" or "team/app@sha256:...".
+type testRegistry struct {
+	mu         sync.Mutex
+	manifests  map[string][]byte
+	mediaTypes map[string]string
+	blobs      map[string][]byte
+
+	// Blobs mounted from another repository and blobs read, by digest
+	mounted   []string
+	blobReads []string
+}
+
+func newTestRegistry(t *testing.T) (*testRegistry, string) {
+	testRegistry := &testRegistry{
+		manifests:  map[string][]byte{},
+		mediaTypes: map[string]string{},
+		blobs:      map[string][]byte{},
+	}
+	server := httptest.NewServer(testRegistry)
+	t.Cleanup(server.Close)
+
+	return testRegistry, strings.TrimPrefix(server.URL, "http://")
+}
+
+// addBlob stores content as a blob of repository.
+func (g *testRegistry) addBlob(repository string, mediaType string, content []byte) ocispec.Descriptor {
+	descriptor := ocispec.Descriptor{MediaType: mediaType, Digest: digest.FromBytes(content), Size: int64(len(content))}
+	g.blobs[repository+"@"+descriptor.Digest.String()] = content
+
+	return descriptor
+}
+
+// addManifest stores manifest in repository by its digest and as tag, if set.
+func (g *testRegistry) addManifest(t *testing.T, repository string, tag string, mediaType string, manifest any) ocispec.Descriptor {
+	content, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	descriptor := ocispec.Descriptor{MediaType: mediaType, Digest: digest.FromBytes(content), Size: int64(len(content))}
+	keys := []string{repository + "@" + descriptor.Digest.String()}
+	if tag != "" {
+		keys = append(keys, repository+":"+tag)
+	}
+	for _, key := range keys {
+		g.manifests[key] = content
+		g.mediaTypes[key] = mediaType
+	}
+
+	return descriptor
+}
+
+func (g *testRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	urlPath := r.URL.Path
+	switch {
+	case strings.HasPrefix(urlPath, "/upload/"):
+		repository := strings.TrimPrefix(urlPath, "/upload/")
+		content, _ := io.ReadAll(r.Body)
+		if digest.FromBytes(content).String() != r.URL.Query().Get("digest") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		g.blobs[repository+"@"+r.URL.Query().Get("digest")] = content
+		w.WriteHeader(http.StatusCreated)
+
+	case strings.Contains(urlPath, "/manifests/"):
+		repository, reference, _ := strings.Cut(strings.TrimPrefix(urlPath, "/v2/"), "/manifests/")
+		key := repository + ":" + reference
+		if strings.HasPrefix(reference, "sha256:") {
+			key = repository + "@" + reference
+		}
+
+		if r.Method == http.MethodPut {
+			content, _ := io.ReadAll(r.Body)
+			manifestDigest := digest.FromBytes(content).String()
+			for _, key := range []string{key, repository + "@" + manifestDigest} {
+				g.manifests[key] = content
+				g.mediaTypes[key] = r.Header.Get("Content-Type")
+			}
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+
+		content, ok := g.manifests[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", g.mediaTypes[key])
+		w.Header().Set("Docker-Content-Digest", digest.FromBytes(content).String())
+		w.Write(content)
+
+	case strings.HasSuffix(urlPath, "/blobs/uploads/"):
+		repository := strings.TrimSuffix(strings.TrimPrefix(urlPath, "/v2/"), "/blobs/uploads/")
+		mount, from := r.URL.Query().Get("mount"), r.URL.Query().Get("from")
+		if content, ok := g.blobs[from+"@"+mount]; ok && mount != "" {
+			g.blobs[repository+"@"+mount] = content
+			g.mounted = append(g.mounted, mount)
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		w.Header().Set("Location", "/upload/"+repository)
+		w.WriteHeader(http.StatusAccepted)
+
+	case strings.Contains(urlPath, "/blobs/"):
+		repository, blobDigest, _ := strings.Cut(strings.TrimPrefix(urlPath, "/v2/"), "/blobs/")
+		content, ok := g.blobs[repository+"@"+blobDigest]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Method == http.MethodGet {
+			g.blobReads = append(g.blobReads, blobDigest)
+			w.Write(content)
+		}
+
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// TestCopyManifestIndex checks that an index is copied to another registry
+// with the manifests of its platforms and their blobs, keeping its digest.
+func TestCopyManifestIndex(t *testing.T) {
+
+	source, sourceAddress := newTestRegistry(t)
+	destination, destinationAddress := newTestRegistry(t)
+
+	platformManifests := []ocispec.Descriptor{}
+	for _, architecture := range []string{"amd64", "arm64"} {
+		config := source.addBlob("team/app", ocispec.MediaTypeImageConfig, []byte(`{"architecture":"`+architecture+`","os":"linux"}`))
+		layer := source.addBlob("team/app", ocispec.MediaTypeImageLayerGzip, []byte("layer of "+architecture))
+		platformManifest := source.addManifest(t, "team/app", "", ocispec.MediaTypeImageManifest, ocispec.Manifest{
+			MediaType: ocispec.MediaTypeImageManifest,
+			Config:    config,
+			Layers:    []ocispec.Descriptor{layer},
+		})
+		platformManifest.Platform = &ocispec.Platform{OS: "linux", Architecture: architecture}
+		platformManifests = append(platformManifests, platformManifest)
+	}
+	index := source.addManifest(t, "team/app", "v1", ocispec.MediaTypeImageIndex, ocispec.Index{
+		MediaType: ocispec.MediaTypeImageIndex,
+		Manifests: platformManifests,
+	})
+
+	imageCopy := &imageCopy{
+		source:                newRegistryClient(sourceAddress, registry.AuthConfig{}, true, nil),
+		sourceRepository:      "team/app",
+		destination:           newRegistryClient(destinationAddress, registry.AuthConfig{}, true, nil),
+		destinationRepository: "mirror/app",
+	}
+	copiedDigest, err := imageCopy.copyManifest(context.Background(), "v1", "v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if copiedDigest != index.Digest.String() {
+		t.Fatalf("Digest is incorrect! Expected %s but found %s.", index.Digest, copiedDigest)
+	}
+	if string(destination.manifests["mirror/app:v1"]) != string(source.manifests["team/app:v1"]) {
+		t.Fatalf("Index was not copied byte for byte: %s", destination.manifests["mirror/app:v1"])
+	}
+	for _, platformManifest := range platformManifests {
+		if _, ok := destination.manifests["mirror/app@"+platformManifest.Digest.String()]; !ok {
+			t.Fatalf("Manifest %s of %s was not copied.", platformManifest.Digest, platformManifest.Platform.Architecture)
+		}
+	}
+	for key := range source.blobs {
+		blobDigest := strings.TrimPrefix(key, "team/app@")
+		if _, ok := destination.blobs["mirror/app@"+blobDigest]; !ok {
+			t.Fatalf("Blob %s was not copied.", blobDigest)
+		}
+	}
+}
+
+// TestCopyBlobMountsWithinRegistry checks that blobs are mounted from the
+// source repository, rather than read and uploaded again, when both
+// repositories are in the same registry.
+func TestCopyBlobMountsWithinRegistry(t *testing.T) {
+
+	testRegistry, address := newTestRegistry(t)
+	layer := testRegistry.addBlob("team/app", ocispec.MediaTypeImageLayerGzip, []byte("layer"))
+
+	registryClient := newRegistryClient(address, registry.AuthConfig{}, true, nil)
+	imageCopy := &imageCopy{
+		source:                registryClient,
+		sourceRepository:      "team/app",
+		destination:           registryClient,
+		destinationRepository: "release/app",
+		sameRegistry:          true,
+	}
+	if err := imageCopy.copyBlob(context.Background(), layer); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(testRegistry.mounted) != 1 || testRegistry.mounted[0] != layer.Digest.String() {
+		t.Fatalf("Blob was not mounted! Expected %s to be mounted but found %v.", layer.Digest, testRegistry.mounted)
+	}
+	if len(testRegistry.blobReads) > 0 {
+		t.Fatalf("Blob was read from the source: %v", testRegistry.blobReads)
+	}
+	if _, ok := testRegistry.blobs["release/app@"+layer.Digest.String()]; !ok {
+		t.Fatalf("Blob is missing from the destination repository.")
+	}
+}
@@ -3,7 +3,6 @@ package provider
 import (
 	"context"
 	"fmt"
-	"strings"
 	"time"
 
 	"github.com/docker/docker/api/types/image"
@@ -97,9 +96,10 @@ func (d *dockerimageDataSource) Read(ctx context.Context, req datasource.ReadReq
 		tag := "<none>"
 
 		if len(image.RepoTags) > 0 {
-			splitted := strings.Split(image.RepoTags[0], ":")
-			name = splitted[0]
-			tag = splitted[1]
+			if repository, repoTag, err := splitRepoTag(image.RepoTags[0]); err == nil {
+				name = repository
+				tag = repoTag
+			}
 		}
 
 		// Converts unix timestamp to time object
@@ -132,15 +132,20 @@ func (d *dockerimageDataSource) Configure(_ context.Context, req datasource.Conf
 		return
 	}
 
-	client, ok := req.ProviderData.(*client.Client)
+	providerData, ok := req.ProviderData.(*dockerProviderData)
 	if !ok {
 		resp.Diagnostics.AddError(
 			"Unexpected Data Source Configure Type",
-			fmt.Sprintf("Expected *hashicups.Client, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+			fmt.Sprintf("Expected *dockerProviderData, got: %T. Please report this issue to the provider developers.", req.ProviderData),
 		)
 
 		return
 	}
 
-	d.client = client
+	providerData.requireDaemon("data.docker_image", &resp.Diagnostics)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	d.client = providerData.client
 }
@@ -0,0 +1,355 @@
+package provider
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/boolplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/listplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+// Ensure the implementation satisfies the expected interfaces.
+var (
+	_ resource.Resource               = &imageLoadResource{}
+	_ resource.ResourceWithConfigure  = &imageLoadResource{}
+	_ resource.ResourceWithModifyPlan = &imageLoadResource{}
+)
+
+// NewImageLoadResource is a helper function to simplify the provider implementation.
+func NewImageLoadResource() resource.Resource {
+	return &imageLoadResource{}
+}
+
+// imageLoadResource is the resource implementation.
+type imageLoadResource struct {
+	client *client.Client
+	retry  retryConfig
+}
+
+// Metadata returns the resource type name.
+func (r *imageLoadResource) Metadata(_ context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_image_load"
+}
+
+type imageLoadResourceModel struct {
+	ID          types.String `tfsdk:"id"`
+	Input       types.String `tfsdk:"input"`
+	InputHash   types.String `tfsdk:"input_hash"`
+	Images      types.List   `tfsdk:"images"`
+	KeepLocally types.Bool   `tfsdk:"keep_locally"`
+}
+
+// Schema defines the schema for the resource.
+func (r *imageLoadResource) Schema(_ context.Context, _ resource.SchemaRequest, resp *resource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		Description: "Loads images from a tar archive, as written by docker save or by an OCI exporter, into the daemon.",
+		Attributes: map[string]schema.Attribute{
+			"id": schema.StringAttribute{
+				Description: "ID of the first image loaded from the archive.",
+				Computed:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"input": schema.StringAttribute{
+				Description: "Path of the archive to load.",
+				Required:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"input_hash": schema.StringAttribute{
+				Description: "SHA256 of the archive. The images are loaded again when it changes.",
+				Computed:    true,
+			},
+			"images": schema.ListAttribute{
+				Description: "References of the images loaded from the archive, e.g. \"app:1.0\", or their IDs if the archive does not tag them.",
+				ElementType: types.StringType,
+				Computed:    true,
+				PlanModifiers: []planmodifier.List{
+					listplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"keep_locally": schema.BoolAttribute{
+				Description: "Keep the loaded images in the daemon when the resource is destroyed.",
+				Optional:    true,
+				PlanModifiers: []planmodifier.Bool{
+					boolplanmodifier.RequiresReplace(),
+				},
+			},
+		},
+	}
+}
+
+// ModifyPlan computes the input_hash of the archive and loads it again if it
+// differs from the one the images were loaded from.
+func (r *imageLoadResource) ModifyPlan(ctx context.Context, req resource.ModifyPlanRequest, resp *resource.ModifyPlanResponse) {
+	// Nothing to load when the resource is destroyed
+	if req.Plan.Raw.IsNull() {
+		return
+	}
+
+	var input types.String
+	resp.Diagnostics.Append(req.Plan.GetAttribute(ctx, path.Root("input"), &input)...)
+	if resp.Diagnostics.HasError() || input.IsUnknown() {
+		return
+	}
+
+	// The archive may not exist yet, e.g. if it is written by another
+	// resource, in which case the hash is computed when it is loaded
+	inputHash, err := fileHash(input.ValueString())
+	if err != nil {
+		return
+	}
+	resp.Diagnostics.Append(resp.Plan.SetAttribute(ctx, path.Root("input_hash"), inputHash)...)
+
+	if req.State.Raw.IsNull() {
+		return
+	}
+
+	var stateInputHash types.String
+	resp.Diagnostics.Append(req.State.GetAttribute(ctx, path.Root("input_hash"), &stateInputHash)...)
+	if stateInputHash.ValueString() != inputHash {
+		resp.RequiresReplace = append(resp.RequiresReplace, path.Root("input_hash"))
+	}
+}
+
+// Create creates the resource and sets the initial Terraform state.
+func (r *imageLoadResource) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
+	var plan imageLoadResourceModel
+	diags := req.Plan.Get(ctx, &plan)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	inputHash, err := fileHash(plan.Input.ValueString())
+	if err != nil {
+		resp.Diagnostics.AddAttributeError(
+			path.Root("input"),
+			"Unable to read image archive",
+			"Could not read image archive, unexpected error: "+err.Error(),
+		)
+		return
+	}
+
+	images, err := loadImageArchive(r, ctx, plan.Input.ValueString())
+	if err != nil {
+		tflog.Debug(ctx, "Unable to load docker image")
+		tflog.Debug(ctx, err.Error())
+
+		resp.Diagnostics.AddError(
+			"Unable to load docker image",
+			"Could not load docker image, unexpected error: "+err.Error(),
+		)
+		return
+	}
+	if len(images) == 0 {
+		resp.Diagnostics.AddError(
+			"Unable to load docker image",
+			"Could not find any image in "+plan.Input.ValueString()+".",
+		)
+		return
+	}
+
+	imageInspect, _, err := r.client.ImageInspectWithRaw(ctx, images[0])
+	if err != nil {
+		resp.Diagnostics.AddError(
+			"Unable to read docker image",
+			"Could not read loaded docker image "+images[0]+", unexpected error: "+err.Error(),
+		)
+		return
+	}
+
+	plan.ID = types.StringValue(imageInspect.ID)
+	plan.InputHash = types.StringValue(inputHash)
+	plan.Images, diags = types.ListValueFrom(ctx, types.StringType, images)
+	resp.Diagnostics.Append(diags...)
+
+	// Set state to fully populated data
+	diags = resp.State.Set(ctx, &plan)
+
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+}
+
+// Read refreshes the Terraform state with the latest data.
+func (r *imageLoadResource) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
+	var state imageLoadResourceModel
+	diags := req.State.Get(ctx, &state)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	images := []string{}
+	diags = state.Images.ElementsAs(ctx, &images, false)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	// The images are loaded again if any of them has been removed
+	for _, loadedImage := range images {
+		err := retryOnTransientError(ctx, r.retry, "image inspect", func() error {
+			_, _, err := r.client.ImageInspectWithRaw(ctx, loadedImage)
+			return err
+		})
+		if errdefs.IsNotFound(err) {
+			resp.State.RemoveResource(ctx)
+			return
+		}
+		if err != nil {
+			resp.Diagnostics.AddError(
+				"Unable to read docker image",
+				"Could not read docker image "+loadedImage+", unexpected error: "+err.Error(),
+			)
+			return
+		}
+	}
+}
+
+// Update updates the resource and sets the updated Terraform state on success.
+func (r *imageLoadResource) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
+}
+
+// Delete deletes the resource and removes the Terraform state on success.
+func (r *imageLoadResource) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
+	var state imageLoadResourceModel
+	diags := req.State.Get(ctx, &state)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if state.KeepLocally.ValueBool() {
+		return
+	}
+
+	images := []string{}
+	diags = state.Images.ElementsAs(ctx, &images, false)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	for _, loadedImage := range images {
+		err := retryOnTransientError(ctx, r.retry, "image remove", func() error {
+			_, err := r.client.ImageRemove(ctx, loadedImage, image.RemoveOptions{Force: true, PruneChildren: true})
+			return err
+		})
+		if err != nil && !errdefs.IsNotFound(err) {
+			tflog.Debug(ctx, "Unable to remove docker image")
+			tflog.Debug(ctx, err.Error())
+
+			resp.Diagnostics.AddError(
+				"Unable to remove docker image",
+				"Could not remove docker image "+loadedImage+", unexpected error: "+err.Error(),
+			)
+		}
+	}
+}
+
+// Configure adds the provider configured client to the resource.
+func (r *imageLoadResource) Configure(_ context.Context, req resource.ConfigureRequest, resp *resource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+
+	providerData, ok := req.ProviderData.(*dockerProviderData)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Resource Configure Type",
+			fmt.Sprintf("Expected *dockerProviderData, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+		)
+
+		return
+	}
+
+	providerData.requireDaemon("docker_image_load", &resp.Diagnostics)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	r.client = providerData.client
+	r.retry = providerData.retry
+}
+
+// loadImageArchive loads the archive at input into the daemon and returns the
+// references of the loaded images, as reported by the daemon.
+func loadImageArchive(r *imageLoadResource, ctx context.Context, input string) ([]string, error) {
+	archive, err := os.Open(input)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+
+	loadResponse, err := r.client.ImageLoad(ctx, archive, true)
+	if err != nil {
+		return nil, err
+	}
+	defer loadResponse.Body.Close()
+
+	// The daemon reports each image as "Loaded image: <reference>" or, for
+	// untagged images, "Loaded image ID: <id>"
+	images := []string{}
+	decoder := json.NewDecoder(loadResponse.Body)
+	for {
+		var message jsonmessage.JSONMessage
+		if err := decoder.Decode(&message); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+		if message.Error != nil {
+			return nil, message.Error
+		}
+
+		for _, line := range strings.Split(message.Stream, "\n") {
+			if loadedImage, found := strings.CutPrefix(line, "Loaded image ID: "); found {
+				images = append(images, strings.TrimSpace(loadedImage))
+			} else if loadedImage, found := strings.CutPrefix(line, "Loaded image: "); found {
+				images = append(images, strings.TrimSpace(loadedImage))
+			}
+		}
+	}
+
+	return images, nil
+}
+
+// fileHash returns the SHA256 of the file at name.
+func fileHash(name string) (string, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
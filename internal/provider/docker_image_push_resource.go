@@ -2,25 +2,41 @@ package provider
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"maps"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 
+	dockertypes "github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/image"
 	"github.com/docker/docker/api/types/registry"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
 	"github.com/hashicorp/terraform-plugin-framework/resource"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/boolplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/mapplanmodifier"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/tfsdk"
 	"github.com/hashicorp/terraform-plugin-framework/types"
 	"github.com/hashicorp/terraform-plugin-log/tflog"
 )
 
 // Ensure the implementation satisfies the expected interfaces.
 var (
-	_ resource.Resource              = &imagePushResource{}
-	_ resource.ResourceWithConfigure = &imagePushResource{}
+	_ resource.Resource                = &imagePushResource{}
+	_ resource.ResourceWithConfigure   = &imagePushResource{}
+	_ resource.ResourceWithImportState = &imagePushResource{}
+	_ resource.ResourceWithModifyPlan  = &imagePushResource{}
 )
 
 // NewimagePushResource is a helper function to simplify the provider implementation.
@@ -30,7 +46,13 @@ func NewImagePushResource() resource.Resource {
 
 // imagePushResource is the resource implementation.
 type imagePushResource struct {
-	client *client.Client
+	client             *client.Client
+	registryAuths      map[string]registry.AuthConfig
+	insecureRegistries map[string]bool
+	registryTransports *registryTransports
+	configDir          string
+	retry              retryConfig
+	timeouts           operationTimeouts
 }
 
 // Metadata returns the resource type name.
@@ -39,67 +61,175 @@ func (r *imagePushResource) Metadata(_ context.Context, req resource.MetadataReq
 }
 
 type imagePushResourceModel struct {
-	PushImageOn   types.String `tfsdk:"push_image_on"`
-	Image         types.String `tfsdk:"image"`
-	Username      types.String `tfsdk:"username"`
-	Password      types.String `tfsdk:"password"`
-	ServerAddress types.String `tfsdk:"server_address"`
-	IdentityToken types.String `tfsdk:"identity_token"`
-	RegistryToken types.String `tfsdk:"registry_token"`
-	PushResult    types.String `tfsdk:"push_result"`
+	PushImageOn    types.String            `tfsdk:"push_image_on"`
+	Triggers       types.Map               `tfsdk:"triggers"`
+	Image          types.String            `tfsdk:"image"`
+	Username       types.String            `tfsdk:"username"`
+	Password       types.String            `tfsdk:"password"`
+	ServerAddress  types.String            `tfsdk:"server_address"`
+	IdentityToken  types.String            `tfsdk:"identity_token"`
+	RegistryToken  types.String            `tfsdk:"registry_token"`
+	Platform       types.String            `tfsdk:"platform"`
+	Insecure       types.Bool              `tfsdk:"insecure"`
+	AllTags        types.Bool              `tfsdk:"all_tags"`
+	AllowOverwrite types.Bool              `tfsdk:"allow_overwrite"`
+	DeleteRemote   types.Bool              `tfsdk:"delete_remote_on_destroy"`
+	CreateRepo     types.Bool              `tfsdk:"create_repository_if_missing"`
+	Digest         types.String            `tfsdk:"digest"`
+	PushResult     types.String            `tfsdk:"push_result"`
+	Retry          *imagePushRetryModel    `tfsdk:"retry"`
+	Timeouts       *imagePushTimeoutsModel `tfsdk:"timeouts"`
+}
+
+type imagePushRetryModel struct {
+	Attempts types.Int64  `tfsdk:"attempts"`
+	MinDelay types.String `tfsdk:"min_delay"`
+	MaxDelay types.String `tfsdk:"max_delay"`
+}
+
+// config returns the retries of the push, starting from those of the
+// provider for the attributes that are unset.
+func (m *imagePushRetryModel) config(defaults retryConfig, diagnostics *diag.Diagnostics) retryConfig {
+	if m == nil {
+		return defaults
+	}
+
+	config := defaults
+	if !m.Attempts.IsNull() {
+		if m.Attempts.ValueInt64() < 1 {
+			diagnostics.AddAttributeError(
+				path.Root("retry").AtName("attempts"),
+				"Invalid retry attempts",
+				"attempts must be at least 1.",
+			)
+		}
+		config.maxRetries = m.Attempts.ValueInt64() - 1
+	}
+	config.delay = parseDurationAttribute(m.MinDelay, path.Root("retry").AtName("min_delay"), defaults.delay, diagnostics)
+	config.maxDelay = parseDurationAttribute(m.MaxDelay, path.Root("retry").AtName("max_delay"), defaults.maxDelay, diagnostics)
+
+	return config
+}
+
+type imagePushTimeoutsModel struct {
+	Create types.String `tfsdk:"create"`
+	Push   types.String `tfsdk:"push"`
+}
+
+// push returns the push timeout of the timeouts block, which may be unset.
+// create is the conventional name of the same timeout, as the push is what
+// creates the resource.
+func (m *imagePushTimeoutsModel) push() types.String {
+	if m == nil {
+		return types.StringNull()
+	}
+	if m.Push.IsNull() {
+		return m.Create
+	}
+	return m.Push
 }
 
 // Schema defines the schema for the resource.
 func (r *imagePushResource) Schema(_ context.Context, _ resource.SchemaRequest, resp *resource.SchemaResponse) {
 	resp.Schema = schema.Schema{
+		Description: "Pushes an image from the Docker daemon to its registry. The daemon uploads the layers, as many at a time as its max-concurrent-uploads setting allows (5 by default); the Engine API has no per-push setting, so set it in the daemon.json of the daemon to limit or raise the concurrency of pushes.",
 		Attributes: map[string]schema.Attribute{
 			"push_image_on": schema.StringAttribute{
-				Description: "Pushes the image if this value is updated.",
-				Optional:    true,
+				Description:        "Pushes the image if this value is updated. Deprecated, use triggers instead.",
+				DeprecationMessage: "Use triggers instead. Moving the value to triggers = { push_image_on = ... } does not push the image again.",
+				Optional:           true,
 				PlanModifiers: []planmodifier.String{
-					stringplanmodifier.RequiresReplace(),
+					stringplanmodifier.RequiresReplaceIf(repushUnlessMigratedString, repushDescription, repushDescription),
+				},
+			},
+			"triggers": schema.MapAttribute{
+				Description: "Arbitrary values that push the image again when they change, e.g. the id of the docker_image that builds it, so that a rebuilt image is pushed on the same apply. Any added, removed or changed value pushes the image again, and the plan warns which values changed. Values that are unknown until apply, such as the id of an image that is rebuilt, push the image again.",
+				ElementType: types.StringType,
+				Optional:    true,
+				PlanModifiers: []planmodifier.Map{
+					mapplanmodifier.RequiresReplaceIf(repushUnlessMigratedMap, repushDescription, repushDescription),
 				},
 			},
 			"image": schema.StringAttribute{
-				Description: "Repository and tag of the image in the format repository:tag.",
+				Description: "Repository and tag of the image in the format repository:tag, or only the repository if all_tags is set.",
 				Required:    true,
 				PlanModifiers: []planmodifier.String{
-					stringplanmodifier.RequiresReplace(),
+					stringplanmodifier.RequiresReplaceIf(repushUnlessImportedString, repushDescription, repushDescription),
 				},
 			},
 			"username": schema.StringAttribute{
 				Description: "Username of AuthConfig struct as specified in https://pkg.go.dev/github.com/docker/docker/api/types/registry#AuthConfig",
 				Optional:    true,
 				PlanModifiers: []planmodifier.String{
-					stringplanmodifier.RequiresReplace(),
+					stringplanmodifier.RequiresReplaceIf(repushUnlessImportedString, repushDescription, repushDescription),
 				},
 			},
 			"password": schema.StringAttribute{
 				Description: "Password of AuthConfig struct as specified in https://pkg.go.dev/github.com/docker/docker/api/types/registry#AuthConfig",
 				Optional:    true,
 				PlanModifiers: []planmodifier.String{
-					stringplanmodifier.RequiresReplace(),
+					stringplanmodifier.RequiresReplaceIf(repushUnlessImportedString, repushDescription, repushDescription),
 				},
 			},
 			"server_address": schema.StringAttribute{
 				Description: "server_address is the ServerAddress in the AuthConfig struct as specified in https://pkg.go.dev/github.com/docker/docker/api/types/registry#AuthConfig",
 				Optional:    true,
 				PlanModifiers: []planmodifier.String{
-					stringplanmodifier.RequiresReplace(),
+					stringplanmodifier.RequiresReplaceIf(repushUnlessImportedString, repushDescription, repushDescription),
 				},
 			},
 			"identity_token": schema.StringAttribute{
 				Description: "identity_token refers to IdentityToken, used to authenticate the user and get an access token for the registry as specified in https://pkg.go.dev/github.com/docker/docker/api/types/registry#AuthConfig",
 				Optional:    true,
 				PlanModifiers: []planmodifier.String{
-					stringplanmodifier.RequiresReplace(),
+					stringplanmodifier.RequiresReplaceIf(repushUnlessImportedString, repushDescription, repushDescription),
 				},
 			},
 			"registry_token": schema.StringAttribute{
 				Description: "registry_token refers to RegistryToken, a bearer token to be sent to a registry as specified in https://pkg.go.dev/github.com/docker/docker/api/types/registry#AuthConfig",
 				Optional:    true,
 				PlanModifiers: []planmodifier.String{
-					stringplanmodifier.RequiresReplace(),
+					stringplanmodifier.RequiresReplaceIf(repushUnlessImportedString, repushDescription, repushDescription),
+				},
+			},
+			"platform": schema.StringAttribute{
+				Description: "Push only this platform of a multi-platform image, e.g. linux/arm64, like docker push --platform. Requires the containerd image store and Docker Engine API 1.46.",
+				Optional:    true,
+				Validators: []validator.String{
+					platformValidator{},
+				},
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplaceIf(repushUnlessImportedString, repushDescription, repushDescription),
+				},
+			},
+			"insecure": schema.BoolAttribute{
+				Description: "Treat the registry of image as an insecure registry, served over plain HTTP or with an untrusted certificate, like the insecure_registries of the provider. The registry must also be in the insecure-registries of the daemon, which pushes the image.",
+				Optional:    true,
+			},
+			"all_tags": schema.BoolAttribute{
+				Description: "Push all local tags of the repository in image, e.g. every tag of a docker_image, like docker push --all-tags.",
+				Optional:    true,
+				PlanModifiers: []planmodifier.Bool{
+					boolplanmodifier.RequiresReplaceIf(repushUnlessImportedBool, repushDescription, repushDescription),
+				},
+			},
+			"allow_overwrite": schema.BoolAttribute{
+				Description: "Push even if the tag already exists in the registry with another digest. Defaults to true. Set to false to protect release tags from being overwritten. Not checked if all_tags is set.",
+				Optional:    true,
+			},
+			"delete_remote_on_destroy": schema.BoolAttribute{
+				Description: "Delete the pushed manifest from the registry when the resource is destroyed, e.g. for the images of ephemeral preview environments. All tags of the registry that point at the same manifest are deleted with it. Requires a registry that allows deletes.",
+				Optional:    true,
+			},
+			"create_repository_if_missing": schema.BoolAttribute{
+				Description: "Create the repository of image if the push fails because it does not exist, so that the first push does not depend on an aws_ecr_repository. Only supported for Amazon ECR registries. The repository is created with the static credentials of the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and optional AWS_SESSION_TOKEN environment variables only: shared config profiles, SSO, web identity and EC2 or ECS roles are not supported, so export the credentials of those first, e.g. with aws configure export-credentials --format env. The repository is not deleted on destroy.",
+				Optional:    true,
+			},
+			"digest": schema.StringAttribute{
+				Description: "Digest of the pushed manifest, e.g. \"sha256:...\". The image is pushed again if the tag in the registry is deleted or points at another digest. Null if all_tags is set.",
+				Computed:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
 				},
 			},
 			"push_result": schema.StringAttribute{
@@ -107,6 +237,38 @@ func (r *imagePushResource) Schema(_ context.Context, _ resource.SchemaRequest,
 				Computed:    true,
 			},
 		},
+		Blocks: map[string]schema.Block{
+			"retry": schema.SingleNestedBlock{
+				Description: "Retries of the push on transient registry errors, such as server errors, invalid blob uploads and timeouts. Unset attributes are inherited from max_retries and retry_delay of the provider.",
+				Attributes: map[string]schema.Attribute{
+					"attempts": schema.Int64Attribute{
+						Description: "Number of times the push is attempted, including the first one.",
+						Optional:    true,
+					},
+					"min_delay": schema.StringAttribute{
+						Description: "Delay before the first retry, doubled after each attempt, e.g. \"2s\".",
+						Optional:    true,
+					},
+					"max_delay": schema.StringAttribute{
+						Description: "Maximum delay between retries, e.g. \"1m\". Defaults to no maximum.",
+						Optional:    true,
+					},
+				},
+			},
+			"timeouts": schema.SingleNestedBlock{
+				Description: "Timeouts of this push, e.g. \"30m\". Unset timeouts are inherited from the timeouts block of the provider.",
+				Attributes: map[string]schema.Attribute{
+					"create": schema.StringAttribute{
+						Description: "Timeout for pushing the image, the same as push.",
+						Optional:    true,
+					},
+					"push": schema.StringAttribute{
+						Description: "Timeout for pushing the image.",
+						Optional:    true,
+					},
+				},
+			},
+		},
 	}
 }
 
@@ -119,75 +281,168 @@ func (r *imagePushResource) Create(ctx context.Context, req resource.CreateReque
 		return
 	}
 
-	authConfig := registry.AuthConfig{
-		Username:      plan.Username.ValueString(),
-		Password:      plan.Password.ValueString(),
-		ServerAddress: plan.ServerAddress.ValueString(),
-		IdentityToken: plan.IdentityToken.ValueString(),
-		RegistryToken: plan.RegistryToken.ValueString(),
+	timeoutPath := path.Root("timeouts").AtName("push")
+	if plan.Timeouts != nil && plan.Timeouts.Push.IsNull() {
+		timeoutPath = path.Root("timeouts").AtName("create")
+	}
+	ctx, cancel := withOperationTimeout(ctx, plan.Timeouts.push(), timeoutPath, r.timeouts.push, &resp.Diagnostics)
+	defer cancel()
+	if resp.Diagnostics.HasError() {
+		return
 	}
 
-	authConfigEncoded, _ := registry.EncodeAuthConfig(authConfig)
-
-	pushResult, err := r.client.ImagePush(
-		ctx,
-		plan.Image.ValueString(),
-		image.PushOptions{
-			RegistryAuth: authConfigEncoded,
-		})
+	if plan.AllTags.ValueBool() {
+		// All tags are pushed from the repository, as with docker push
+		if hasTag(plan.Image.ValueString()) {
+			resp.Diagnostics.AddAttributeError(
+				path.Root("image"),
+				"Invalid image",
+				"Image "+plan.Image.ValueString()+" must be a repository without a tag when all_tags is set.",
+			)
+			return
+		}
+		if plan.DeleteRemote.ValueBool() {
+			resp.Diagnostics.AddAttributeError(
+				path.Root("delete_remote_on_destroy"),
+				"Invalid delete_remote_on_destroy",
+				"delete_remote_on_destroy deletes a single tag and cannot be set together with all_tags.",
+			)
+			return
+		}
+	} else if _, _, err := splitRepoTag(plan.Image.ValueString()); err != nil {
+		// Only tags can be pushed, e.g. "registry.local:5000/app:v1"
+		resp.Diagnostics.AddAttributeError(
+			path.Root("image"),
+			"Invalid image",
+			"Could not parse image "+plan.Image.ValueString()+" as repository:tag: "+err.Error(),
+		)
+		return
+	}
 
+	authConfigEncoded, err := r.registryAuth(ctx, &plan)
 	if err != nil {
-		tflog.Debug(ctx, "Unable to push docker image")
-		tflog.Debug(ctx, err.Error())
-
 		resp.Diagnostics.AddError(
 			"Unable to push docker image",
-			"Could push Image ID "+plan.Image.ValueString()+": "+err.Error(),
+			"Could not resolve registry of image "+plan.Image.ValueString()+": "+err.Error(),
 		)
+		return
 	}
 
-	buf := new(strings.Builder)
-	_, err = io.Copy(buf, pushResult)
+	warning, err := insecureRegistryWarning(ctx, r.client, r.insecureRegistriesFor(&plan), plan.Image.ValueString())
 	if err != nil {
+		tflog.Debug(ctx, "Unable to check insecure registry configuration of the daemon: "+err.Error())
+	}
+	if warning != "" {
+		resp.Diagnostics.AddWarning("Insecure registry not configured on the Docker daemon", warning)
+	}
 
-		fmt.Println("****Unable to push docker image")
-		fmt.Println(err.Error())
-
-		tflog.Debug(ctx, "Unable to push docker image")
-		tflog.Debug(ctx, err.Error())
+	if plan.CreateRepo.ValueBool() {
+		if address, err := registryAddressFromImage(plan.Image.ValueString()); err != nil || !isECRRegistry(address) {
+			resp.Diagnostics.AddAttributeError(
+				path.Root("create_repository_if_missing"),
+				"Unsupported registry",
+				"Could not push "+plan.Image.ValueString()+", as create_repository_if_missing is only supported for Amazon ECR registries, e.g. 123456789012.dkr.ecr.eu-west-1.amazonaws.com.",
+			)
+			return
+		}
+	}
 
-		resp.Diagnostics.AddError(
-			"Unable to push docker image",
-			"Could push Image ID "+plan.Image.ValueString()+": "+err.Error(),
-		)
+	retry := plan.Retry.config(r.retry, &resp.Diagnostics)
+	if resp.Diagnostics.HasError() {
+		return
 	}
 
-	fmt.Println("buf.String()")
-	fmt.Println(buf.String())
+	if !plan.AllowOverwrite.IsNull() && !plan.AllowOverwrite.ValueBool() && !plan.AllTags.ValueBool() {
+		remoteDigest, err := r.overwrittenDigest(ctx, &plan)
+		if err != nil {
+			resp.Diagnostics.AddError(
+				"Unable to push docker image",
+				"Could not check whether "+plan.Image.ValueString()+" already exists in its registry: "+err.Error(),
+			)
+			return
+		}
+		if remoteDigest != "" {
+			resp.Diagnostics.AddAttributeError(
+				path.Root("image"),
+				"Docker image tag already exists in registry",
+				"Could not push "+plan.Image.ValueString()+", as allow_overwrite is false and the tag already points at "+remoteDigest+" in the registry, which is not the local image. Push to another tag or set allow_overwrite to true.",
+			)
+			return
+		}
+	}
 
-	pushResultSplit := strings.Split(buf.String(), "\n")
+	// Registry errors are reported in the push output rather than by the
+	// call, so the whole push is retried
+	pushOptions := image.PushOptions{
+		All:          plan.AllTags.ValueBool(),
+		RegistryAuth: authConfigEncoded,
+	}
+	if plan.Platform.ValueString() != "" {
+		pushOptions.Platform = ociPlatform(plan.Platform.ValueString())
+	}
 
-	resultMessage := "Push result could not be parsed."
-	for index := len(pushResultSplit) - 1; index >= 0; index-- {
+	var output pushOutput
+	push := func() error {
+		pushResult, err := r.client.ImagePush(ctx, plan.Image.ValueString(), pushOptions)
+		if err != nil {
+			return err
+		}
+		defer pushResult.Close()
 
-		toCompare := strings.ToLower(pushResultSplit[index])
-		if strings.Contains(toCompare, "error") || strings.Contains(toCompare, "digest") {
-			resultMessage = pushResultSplit[index]
-			break
+		output, err = readPushOutput(ctx, pushResult)
+		return err
+	}
+	err = retryOnError(ctx, retry, "image push", isTransientPushError, push)
+
+	if err != nil && plan.CreateRepo.ValueBool() && isMissingRepositoryError(err) {
+		address, _ := registryAddressFromImage(plan.Image.ValueString())
+		repository, _ := repositoryPath(plan.Image.ValueString())
+
+		tflog.Info(ctx, "Creating missing repository "+repository+" in "+address)
+		if err := createECRRepository(ctx, r.registryTransports.httpClient(false), address, repository); err != nil {
+			resp.Diagnostics.AddError(
+				"Unable to push docker image",
+				"Could not create repository "+repository+" of "+plan.Image.ValueString()+", unexpected error: "+err.Error(),
+			)
+			return
 		}
+
+		err = retryOnError(ctx, retry, "image push", isTransientPushError, push)
 	}
 
-	if strings.Contains(buf.String(), "error") || len(buf.String()) == 0 {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		resp.Diagnostics.AddError(
+			"Unable to push docker image",
+			"Could not push "+plan.Image.ValueString()+" before the push timeout expired, set timeouts to allow more time.",
+		)
+		return
+	}
+	if err != nil {
+		tflog.Debug(ctx, "Unable to push docker image")
+		tflog.Debug(ctx, err.Error())
 
 		resp.Diagnostics.AddError(
 			"Unable to push docker image",
-			"Could push Image ID "+plan.Image.ValueString()+": "+"There was an error in the push result. "+resultMessage,
+			"Could push Image ID "+plan.Image.ValueString()+": "+err.Error(),
 		)
+		return
 	}
 
-	plan.PushResult = types.StringValue(resultMessage)
+	// The daemon reports the digest of each pushed tag last
+	if output.result == "" {
+		resp.Diagnostics.AddError(
+			"Unable to push docker image",
+			"Could push Image ID "+plan.Image.ValueString()+": "+"There was an error in the push result. Push result could not be parsed.",
+		)
+	}
 
-	// tflog.Debug(ctx, "Docker image pushed!")
+	tflog.Debug(ctx, "Docker image pushed", map[string]any{"result": output.result})
+
+	plan.PushResult = types.StringValue(output.result)
+	plan.Digest = types.StringNull()
+	if output.digest != "" && !plan.AllTags.ValueBool() {
+		plan.Digest = types.StringValue(output.digest)
+	}
 
 	// Set state to fully populated data
 	diags = resp.State.Set(ctx, &plan)
@@ -198,30 +453,517 @@ func (r *imagePushResource) Create(ctx context.Context, req resource.CreateReque
 	}
 }
 
+// ModifyPlan warns why the image is pushed again when an update of the
+// resource replaces it, e.g. which triggers changed.
+func (r *imagePushResource) ModifyPlan(ctx context.Context, req resource.ModifyPlanRequest, resp *resource.ModifyPlanResponse) {
+	// Only updates push an image again
+	if req.State.Raw.IsNull() || req.Plan.Raw.IsNull() {
+		return
+	}
+
+	imported, diags := req.Private.GetKey(ctx, importedPrivateKey)
+	resp.Diagnostics.Append(diags...)
+	if len(imported) > 0 {
+		return
+	}
+
+	var state, plan imagePushResourceModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	reasons := []string{}
+	if !pushImageOnMigrated(ctx, req.State, req.Plan, &resp.Diagnostics) {
+		if !plan.PushImageOn.Equal(state.PushImageOn) {
+			reasons = append(reasons, "push_image_on changed from "+formatPlanValue(state.PushImageOn)+" to "+formatPlanValue(plan.PushImageOn))
+		}
+		reasons = append(reasons, triggerChanges(state.Triggers, plan.Triggers)...)
+	}
+	if !plan.Image.Equal(state.Image) {
+		reasons = append(reasons, "image changed from "+formatPlanValue(state.Image)+" to "+formatPlanValue(plan.Image))
+	}
+	if !plan.Platform.Equal(state.Platform) {
+		reasons = append(reasons, "platform changed from "+formatPlanValue(state.Platform)+" to "+formatPlanValue(plan.Platform))
+	}
+	if !plan.AllTags.Equal(state.AllTags) {
+		reasons = append(reasons, "all_tags changed")
+	}
+	if !plan.Username.Equal(state.Username) || !plan.Password.Equal(state.Password) || !plan.ServerAddress.Equal(state.ServerAddress) || !plan.IdentityToken.Equal(state.IdentityToken) || !plan.RegistryToken.Equal(state.RegistryToken) {
+		reasons = append(reasons, "the credentials of the push changed")
+	}
+	if len(reasons) == 0 {
+		return
+	}
+
+	resp.Diagnostics.AddWarning(
+		"Docker image will be pushed again",
+		"Image "+plan.Image.ValueString()+" is pushed again, as:\n  - "+strings.Join(reasons, "\n  - "),
+	)
+}
+
+// triggerChanges describes the triggers that were added, removed or changed
+// between state and plan.
+func triggerChanges(state types.Map, plan types.Map) []string {
+	if plan.IsUnknown() {
+		return []string{"triggers are known after apply"}
+	}
+
+	stateElements := state.Elements()
+	planElements := plan.Elements()
+	keys := []string{}
+	for key := range stateElements {
+		keys = append(keys, key)
+	}
+	for key := range planElements {
+		if _, ok := stateElements[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	changes := []string{}
+	for _, key := range keys {
+		before, inState := stateElements[key].(types.String)
+		after, inPlan := planElements[key].(types.String)
+		name := "triggers[" + strconv.Quote(key) + "]"
+		switch {
+		case !inState:
+			changes = append(changes, name+" was added with value "+formatPlanValue(after))
+		case !inPlan:
+			changes = append(changes, name+" was removed")
+		case !before.Equal(after):
+			changes = append(changes, name+" changed from "+formatPlanValue(before)+" to "+formatPlanValue(after))
+		}
+	}
+
+	return changes
+}
+
+// formatPlanValue formats value for plan output.
+func formatPlanValue(value types.String) string {
+	if value.IsUnknown() {
+		return "(known after apply)"
+	}
+	if value.IsNull() {
+		return "null"
+	}
+	return strconv.Quote(value.ValueString())
+}
+
 // Read refreshes the Terraform state with the latest data.
+// The image is pushed again if its tag was deleted from the registry or now
+// points at another digest.
 func (r *imagePushResource) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
-	// // Get current state
-	// var state imageResourceModel
-	// diags := req.State.Get(ctx, &state)
-	// resp.Diagnostics.Append(diags...)
-	// if resp.Diagnostics.HasError() {
-	// 	return
-	// }
-
-	// // Set refreshed state
-	// diags = resp.State.Set(ctx, &state)
-	// resp.Diagnostics.Append(diags...)
-	// if resp.Diagnostics.HasError() {
-	// 	return
-	// }
+	// Get current state
+	var state imagePushResourceModel
+	diags := req.State.Get(ctx, &state)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	// Pushes of all tags, or made before digest was recorded, cannot drift
+	if state.Digest.ValueString() == "" || state.AllTags.ValueBool() {
+		return
+	}
+
+	registryClient, repository, tag, err := r.registryClient(ctx, &state)
+	if err == nil {
+		var digest string
+		digest, err = registryClient.manifestDigest(ctx, repository, tag)
+		if errors.Is(err, errManifestNotFound) {
+			tflog.Info(ctx, "Pushed image deleted from registry", map[string]any{"image": state.Image.ValueString()})
+			resp.State.RemoveResource(ctx)
+			return
+		}
+		if err == nil && digest != state.Digest.ValueString() {
+			tflog.Info(ctx, "Pushed image overwritten in registry", map[string]any{"image": state.Image.ValueString(), "digest": state.Digest.ValueString(), "registry_digest": digest})
+			resp.State.RemoveResource(ctx)
+			return
+		}
+	}
+
+	// The registry may be unreachable from where the plan runs
+	if err != nil {
+		tflog.Warn(ctx, "Unable to check pushed image in registry", map[string]any{"image": state.Image.ValueString(), "error": err.Error()})
+	}
 }
 
 // Update updates the resource and sets the updated Terraform state on success.
 func (r *imagePushResource) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
+	var plan imagePushResourceModel
+	diags := req.Plan.Get(ctx, &plan)
+	resp.Diagnostics.Append(diags...)
+
+	var state imagePushResourceModel
+	diags = req.State.Get(ctx, &state)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	// An imported push adopts the configuration it is first applied with
+	imported, diags := req.Private.GetKey(ctx, importedPrivateKey)
+	resp.Diagnostics.Append(diags...)
+	if len(imported) > 0 {
+		plan.Digest = state.Digest
+		plan.PushResult = state.PushResult
+		state = plan
+		resp.Diagnostics.Append(resp.Private.SetKey(ctx, importedPrivateKey, nil)...)
+	}
+
+	// Other changes of push_image_on or triggers push the image again, so
+	// this is push_image_on moved into triggers
+	state.PushImageOn = plan.PushImageOn
+	state.Triggers = plan.Triggers
+
+	// Timeouts and retries only apply to later pushes
+	state.Timeouts = plan.Timeouts
+	state.Retry = plan.Retry
+	state.DeleteRemote = plan.DeleteRemote
+	state.AllowOverwrite = plan.AllowOverwrite
+	state.CreateRepo = plan.CreateRepo
+	state.Insecure = plan.Insecure
+
+	diags = resp.State.Set(ctx, &state)
+	resp.Diagnostics.Append(diags...)
 }
 
 // Delete deletes the resource and removes the Terraform state on success.
 func (r *imagePushResource) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
+	var state imagePushResourceModel
+	diags := req.State.Get(ctx, &state)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() || !state.DeleteRemote.ValueBool() {
+		return
+	}
+
+	err := r.deleteRemoteImage(ctx, &state)
+	if err != nil {
+		tflog.Debug(ctx, "Unable to delete docker image from registry", map[string]any{"error": err.Error()})
+
+		resp.Diagnostics.AddError(
+			"Unable to delete docker image from registry",
+			"Could not delete "+state.Image.ValueString()+" from its registry, unexpected error: "+err.Error(),
+		)
+	}
+}
+
+// insecureRegistriesFor returns the insecure_registries of the provider,
+// along with the registry of the image if insecure is set on model.
+func (r *imagePushResource) insecureRegistriesFor(model *imagePushResourceModel) map[string]bool {
+	if !model.Insecure.ValueBool() {
+		return r.insecureRegistries
+	}
+
+	insecureRegistries := maps.Clone(r.insecureRegistries)
+	if insecureRegistries == nil {
+		insecureRegistries = map[string]bool{}
+	}
+	if address, err := registryAddressFromImage(model.Image.ValueString()); err == nil {
+		insecureRegistries[address] = true
+	}
+
+	return insecureRegistries
+}
+
+// ImportState imports an image that is already in its registry, by
+// repository:tag, e.g. "registry.local:5000/app:v1", so that it is not pushed
+// again. Credentials are those of the provider.
+func (r *imagePushResource) ImportState(ctx context.Context, req resource.ImportStateRequest, resp *resource.ImportStateResponse) {
+	if _, _, err := splitRepoTag(req.ID); err != nil {
+		resp.Diagnostics.AddError(
+			"Invalid import ID",
+			"Could not parse import ID "+req.ID+" as repository:tag: "+err.Error(),
+		)
+		return
+	}
+
+	model := imagePushResourceModel{Image: types.StringValue(req.ID)}
+	registryClient, repository, tag, err := r.registryClient(ctx, &model)
+	if err != nil {
+		resp.Diagnostics.AddError(
+			"Unable to import docker image push",
+			"Could not resolve registry of image "+req.ID+": "+err.Error(),
+		)
+		return
+	}
+
+	digest, err := registryClient.manifestDigest(ctx, repository, tag)
+	if errors.Is(err, errManifestNotFound) {
+		resp.Diagnostics.AddError(
+			"Unable to import docker image push",
+			"Could not find "+req.ID+" in its registry.",
+		)
+		return
+	}
+	if err != nil {
+		resp.Diagnostics.AddError(
+			"Unable to import docker image push",
+			"Could not read "+req.ID+" from its registry, unexpected error: "+err.Error(),
+		)
+		return
+	}
+
+	resp.Diagnostics.Append(resp.State.SetAttribute(ctx, path.Root("image"), req.ID)...)
+	resp.Diagnostics.Append(resp.State.SetAttribute(ctx, path.Root("digest"), digest)...)
+	resp.Diagnostics.Append(resp.State.SetAttribute(ctx, path.Root("push_result"), "Imported "+req.ID+" with digest "+digest)...)
+	resp.Diagnostics.Append(resp.Private.SetKey(ctx, importedPrivateKey, []byte(`true`))...)
+}
+
+// importedPrivateKey marks the private state of a push that was imported and
+// has not been applied since.
+const importedPrivateKey = "imported"
+
+const repushDescription = "Pushes the image again when the value changes, unless the push was imported and the value is set for the first time."
+
+// repushUnlessImported reports whether a change of an attribute pushes the
+// image again. Attributes set in the configuration of an imported push are
+// unset in its state, which is not a change.
+func repushUnlessImported(ctx context.Context, private interface {
+	GetKey(context.Context, string) ([]byte, diag.Diagnostics)
+}, stateIsNull bool, diagnostics *diag.Diagnostics) bool {
+	imported, diags := private.GetKey(ctx, importedPrivateKey)
+	diagnostics.Append(diags...)
+
+	return len(imported) == 0 || !stateIsNull
+}
+
+func repushUnlessImportedString(ctx context.Context, req planmodifier.StringRequest, resp *stringplanmodifier.RequiresReplaceIfFuncResponse) {
+	resp.RequiresReplace = repushUnlessImported(ctx, req.Private, req.StateValue.IsNull(), &resp.Diagnostics)
+}
+
+func repushUnlessImportedMap(ctx context.Context, req planmodifier.MapRequest, resp *mapplanmodifier.RequiresReplaceIfFuncResponse) {
+	resp.RequiresReplace = repushUnlessImported(ctx, req.Private, req.StateValue.IsNull(), &resp.Diagnostics)
+}
+
+func repushUnlessImportedBool(ctx context.Context, req planmodifier.BoolRequest, resp *boolplanmodifier.RequiresReplaceIfFuncResponse) {
+	resp.RequiresReplace = repushUnlessImported(ctx, req.Private, req.StateValue.IsNull(), &resp.Diagnostics)
+}
+
+// pushImageOnMigrated reports whether push_image_on in state was moved to
+// triggers in plan, as triggers = { push_image_on = ... }, with the same value.
+func pushImageOnMigrated(ctx context.Context, state tfsdk.State, plan tfsdk.Plan, diagnostics *diag.Diagnostics) bool {
+	var statePushImageOn, planPushImageOn types.String
+	var stateTriggers, planTriggers types.Map
+	diagnostics.Append(state.GetAttribute(ctx, path.Root("push_image_on"), &statePushImageOn)...)
+	diagnostics.Append(state.GetAttribute(ctx, path.Root("triggers"), &stateTriggers)...)
+	diagnostics.Append(plan.GetAttribute(ctx, path.Root("push_image_on"), &planPushImageOn)...)
+	diagnostics.Append(plan.GetAttribute(ctx, path.Root("triggers"), &planTriggers)...)
+
+	if statePushImageOn.IsNull() || !planPushImageOn.IsNull() || !stateTriggers.IsNull() || planTriggers.IsUnknown() {
+		return false
+	}
+	elements := planTriggers.Elements()
+	value, ok := elements["push_image_on"]
+
+	return len(elements) == 1 && ok && value.Equal(statePushImageOn)
+}
+
+func repushUnlessMigratedString(ctx context.Context, req planmodifier.StringRequest, resp *stringplanmodifier.RequiresReplaceIfFuncResponse) {
+	if pushImageOnMigrated(ctx, req.State, req.Plan, &resp.Diagnostics) {
+		return
+	}
+	repushUnlessImportedString(ctx, req, resp)
+}
+
+func repushUnlessMigratedMap(ctx context.Context, req planmodifier.MapRequest, resp *mapplanmodifier.RequiresReplaceIfFuncResponse) {
+	if pushImageOnMigrated(ctx, req.State, req.Plan, &resp.Diagnostics) {
+		return
+	}
+	repushUnlessImportedMap(ctx, req, resp)
+}
+
+// registryAuth returns the encoded credentials of the push: those set on the
+// resource, or else the registry_auth of the provider, or else the
+// credentials stored by docker login in config.json or its credential
+// helpers, like the docker CLI. An empty string is returned if there are
+// none, so that the push is anonymous.
+func (r *imagePushResource) registryAuth(ctx context.Context, model *imagePushResourceModel) (string, error) {
+	authConfig := registry.AuthConfig{
+		Username:      model.Username.ValueString(),
+		Password:      model.Password.ValueString(),
+		ServerAddress: model.ServerAddress.ValueString(),
+		IdentityToken: model.IdentityToken.ValueString(),
+		RegistryToken: model.RegistryToken.ValueString(),
+	}
+	// server_address alone is no credential
+	if authConfig.Username != "" || authConfig.Password != "" || authConfig.IdentityToken != "" || authConfig.RegistryToken != "" {
+		return registry.EncodeAuthConfig(authConfig)
+	}
+
+	providerAuth, err := registryAuthForImage(ctx, r.registryAuths, r.insecureRegistriesFor(model), r.configDir, model.Image.ValueString())
+	if err != nil {
+		return "", err
+	}
+	if providerAuth == "" {
+		tflog.Debug(ctx, "No credentials found for registry, pushing anonymously", map[string]any{"image": model.Image.ValueString()})
+	}
+
+	return providerAuth, nil
+}
+
+// deleteRemoteImage deletes the manifest that the pushed tag points at from
+// the registry, through the Registry HTTP API as the daemon cannot.
+func (r *imagePushResource) deleteRemoteImage(ctx context.Context, state *imagePushResourceModel) error {
+	if state.AllTags.ValueBool() {
+		return fmt.Errorf("delete_remote_on_destroy cannot be set together with all_tags")
+	}
+
+	image := state.Image.ValueString()
+	registryClient, repository, tag, err := r.registryClient(ctx, state)
+	if err != nil {
+		return err
+	}
+
+	// Manifests are deleted by digest
+	digest, err := registryClient.manifestDigest(ctx, repository, tag)
+	if errors.Is(err, errManifestNotFound) {
+		tflog.Debug(ctx, "Pushed image no longer in registry", map[string]any{"image": image})
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	tflog.Info(ctx, "Deleting pushed image from registry", map[string]any{"image": image, "digest": digest})
+
+	return registryClient.deleteManifest(ctx, repository, digest)
+}
+
+// overwrittenDigest returns the digest that the tag of the image points at in
+// the registry, if the push would overwrite it with another image, or an
+// empty string otherwise. The local image is the same if it was pushed to or
+// pulled from the registry with that digest before.
+func (r *imagePushResource) overwrittenDigest(ctx context.Context, model *imagePushResourceModel) (string, error) {
+	registryClient, repository, tag, err := r.registryClient(ctx, model)
+	if err != nil {
+		return "", err
+	}
+
+	remoteDigest, err := registryClient.manifestDigest(ctx, repository, tag)
+	if errors.Is(err, errManifestNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var imageInspect dockertypes.ImageInspect
+	err = retryOnTransientError(ctx, r.retry, "image inspect", func() error {
+		var err error
+		imageInspect, _, err = r.client.ImageInspectWithRaw(ctx, model.Image.ValueString())
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	for _, repoDigest := range imageInspect.RepoDigests {
+		repository, digest, err := splitRepoDigest(repoDigest)
+		if err == nil && digest == remoteDigest && sameRepository(repository, model.Image.ValueString()) {
+			return "", nil
+		}
+	}
+
+	return remoteDigest, nil
+}
+
+// registryClient returns a client for the registry of the pushed image, with
+// the credentials of the push, along with the repository and tag of the image
+// in the registry.
+func (r *imagePushResource) registryClient(ctx context.Context, model *imagePushResourceModel) (*registryClient, string, string, error) {
+	_, tag, err := splitRepoTag(model.Image.ValueString())
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	authConfigEncoded, err := r.registryAuth(ctx, model)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	registryClient, repository, err := registryClientForImage(model.Image.ValueString(), authConfigEncoded, r.insecureRegistriesFor(model), r.registryTransports)
+
+	return registryClient, repository, tag, err
+}
+
+// missingRepositoryErrorPattern matches the registry errors of a push to a
+// repository that does not exist, e.g. "name unknown: The repository with name
+// 'app' does not exist in the registry with id '123456789012'".
+var missingRepositoryErrorPattern = regexp.MustCompile(`(?i)name unknown|repository .* does not exist`)
+
+// isMissingRepositoryError reports whether err is the failure of a push to a
+// repository that does not exist.
+func isMissingRepositoryError(err error) bool {
+	return missingRepositoryErrorPattern.MatchString(err.Error())
+}
+
+// transientPushErrorPattern matches the registry errors of a push that are
+// worth retrying: server errors, invalid blob uploads and timeouts.
+var transientPushErrorPattern = regexp.MustCompile(`(?i)(status:? 5\d\d|5\d\d (internal server error|bad gateway|service unavailable|gateway timeout)|blob upload (invalid|unknown)|timeout|timed out|connection reset)`)
+
+// pushDigestPattern matches the digest in the output of a push, e.g.
+// "v1: digest: sha256:... size: 1234".
+var pushDigestPattern = regexp.MustCompile(`digest: (sha256:[0-9a-f]{64})`)
+
+// isTransientPushError reports whether the push failed with err is worth
+// retrying.
+func isTransientPushError(err error) bool {
+	return isTransientError(err) || transientPushErrorPattern.MatchString(err.Error())
+}
+
+// pushOutput is what a push reports once its layers are uploaded.
+type pushOutput struct {
+	// Last status line with a digest, e.g. "v1: digest: sha256:... size: 1234"
+	result string
+	digest string
+}
+
+// pushProgressStep is the step, in percent, at which the upload progress of
+// a layer is logged.
+const pushProgressStep = 25
+
+// readPushOutput reads the JSON messages streamed by the daemon during a
+// push as they arrive, logging the progress of each layer, and returns the
+// result of the push or the first error reported by the registry.
+func readPushOutput(ctx context.Context, r io.Reader) (pushOutput, error) {
+	var output pushOutput
+	loggedPercent := map[string]int64{}
+
+	decoder := json.NewDecoder(r)
+	for {
+		var jsonMessage jsonmessage.JSONMessage
+		if err := decoder.Decode(&jsonMessage); err != nil {
+			if errors.Is(err, io.EOF) {
+				return output, nil
+			}
+			return output, err
+		}
+		if jsonMessage.Error != nil {
+			return output, jsonMessage.Error
+		}
+
+		if progress := jsonMessage.Progress; progress != nil && progress.Total > 0 {
+			percent := progress.Current * 100 / progress.Total
+			if percent-loggedPercent[jsonMessage.ID] >= pushProgressStep {
+				loggedPercent[jsonMessage.ID] = percent
+				tflog.Debug(ctx, "Push progress", map[string]any{"layer": jsonMessage.ID, "status": jsonMessage.Status, "percent": percent})
+			}
+			continue
+		}
+		if jsonMessage.Status == "" {
+			continue
+		}
+
+		tflog.Debug(ctx, "Push status", map[string]any{"layer": jsonMessage.ID, "status": jsonMessage.Status})
+		if match := pushDigestPattern.FindStringSubmatch(jsonMessage.Status); match != nil {
+			output.result = jsonMessage.Status
+			output.digest = match[1]
+		}
+	}
 }
 
 // Configure adds the provider configured client to the data source.
@@ -230,15 +972,26 @@ func (r *imagePushResource) Configure(_ context.Context, req resource.ConfigureR
 		return
 	}
 
-	client, ok := req.ProviderData.(*client.Client)
+	providerData, ok := req.ProviderData.(*dockerProviderData)
 	if !ok {
 		resp.Diagnostics.AddError(
 			"Unexpected Data Source Configure Type",
-			fmt.Sprintf("Expected *hashicups.Client, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+			fmt.Sprintf("Expected *dockerProviderData, got: %T. Please report this issue to the provider developers.", req.ProviderData),
 		)
 
 		return
 	}
 
-	r.client = client
+	providerData.requireDaemon("docker_image_push", &resp.Diagnostics)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	r.client = providerData.client
+	r.registryAuths = providerData.registryAuths
+	r.insecureRegistries = providerData.insecureRegistries
+	r.registryTransports = providerData.registryTransports
+	r.configDir = providerData.configDir
+	r.retry = providerData.retry
+	r.timeouts = providerData.timeouts
 }
@@ -0,0 +1,32 @@
+package provider
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// TestReadPushOutput checks that the digest is read from the status of a push
+// and that registry errors are returned.
+func TestReadPushOutput(t *testing.T) {
+
+	ctx := context.Background()
+	digest := "sha256:" + strings.Repeat("ab", 32)
+
+	output, err := readPushOutput(ctx, strings.NewReader(`{"status":"The push refers to repository [registry.local:5000/app]"}
+{"status":"Pushing","progressDetail":{"current":512,"total":1024},"id":"6a5e"}
+{"status":"Pushed","progressDetail":{},"id":"6a5e"}
+{"status":"v1: digest: `+digest+` size: 528"}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output.digest != digest {
+		t.Fatalf("Digest is incorrect! Expected %s but found %q.", digest, output.digest)
+	}
+
+	_, err = readPushOutput(ctx, strings.NewReader(`{"errorDetail":{"message":"blob upload invalid"},"error":"blob upload invalid"}`))
+	if err == nil || !isTransientPushError(err) {
+		t.Fatalf("Expected a transient push error but found %v.", err)
+	}
+}
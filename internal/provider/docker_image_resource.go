@@ -4,31 +4,58 @@ import (
 	"archive/tar"
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
+	"maps"
 	"os"
+	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
+	"time"
 
 	dockertypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/registry"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
 	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/hashicorp/terraform-plugin-framework/attr"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
 	"github.com/hashicorp/terraform-plugin-framework/path"
 	"github.com/hashicorp/terraform-plugin-framework/resource"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema/boolplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/int64planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/listplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/mapplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/objectplanmodifier"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/setplanmodifier"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/tfsdk"
 	"github.com/hashicorp/terraform-plugin-framework/types"
 	"github.com/hashicorp/terraform-plugin-log/tflog"
+	buildkitclient "github.com/moby/buildkit/client"
+	"github.com/moby/buildkit/identity"
+	"github.com/moby/buildkit/session"
+	"github.com/moby/buildkit/session/secrets/secretsprovider"
+	"github.com/moby/patternmatcher"
+	"github.com/moby/patternmatcher/ignorefile"
 )
 
 // Ensure the implementation satisfies the expected interfaces.
 var (
-	_ resource.Resource              = &imageResource{}
-	_ resource.ResourceWithConfigure = &imageResource{}
+	_ resource.Resource                   = &imageResource{}
+	_ resource.ResourceWithConfigure      = &imageResource{}
+	_ resource.ResourceWithModifyPlan     = &imageResource{}
+	_ resource.ResourceWithValidateConfig = &imageResource{}
 )
 
 // NewimageResource is a helper function to simplify the provider implementation.
@@ -38,7 +65,12 @@ func NewImageResource() resource.Resource {
 
 // imageResource is the resource implementation.
 type imageResource struct {
-	client *client.Client
+	client             *client.Client
+	registryAuths      map[string]registry.AuthConfig
+	insecureRegistries map[string]bool
+	configDir          string
+	retry              retryConfig
+	timeouts           operationTimeouts
 }
 
 // Metadata returns the resource type name.
@@ -58,27 +90,32 @@ func (r *imageResource) Schema(_ context.Context, _ resource.SchemaRequest, resp
 				},
 			},
 			"tags": schema.ListNestedAttribute{
-				Description: "List of image tags.",
+				Description: "List of image tags. Tags are added and removed without rebuilding the image, unless all of them are removed or output is set.",
 				Optional:    true,
+				PlanModifiers: []planmodifier.List{
+					listplanmodifier.RequiresReplaceIf(
+						tagsRequireReplace,
+						"Replaces the image if all of its tags are removed or it is written to output.",
+						"Replaces the image if all of its tags are removed or it is written to `output`.",
+					),
+				},
 				NestedObject: schema.NestedAttributeObject{
 					Attributes: map[string]schema.Attribute{
 						"repository": schema.StringAttribute{
 							Description: "Image name.",
 							Required:    true,
-							PlanModifiers: []planmodifier.String{
-								stringplanmodifier.RequiresReplace(),
-							},
 						},
 						"tag": schema.StringAttribute{
 							Description: "Image tag.",
 							Required:    true,
-							PlanModifiers: []planmodifier.String{
-								stringplanmodifier.RequiresReplace(),
-							},
 						},
 					},
 				},
 			},
+			"overwrite": schema.BoolAttribute{
+				Description: "Move tags that already point at another image in the daemon to this image. Defaults to true. Set to false to fail instead, e.g. to leave alone images tagged by other workspaces.",
+				Optional:    true,
+			},
 			"dir": schema.StringAttribute{
 				Description: "Path to the directory that contains the Dockerfile. Defaults to '\".\".",
 				Optional:    true,
@@ -86,6 +123,13 @@ func (r *imageResource) Schema(_ context.Context, _ resource.SchemaRequest, resp
 					stringplanmodifier.RequiresReplace(),
 				},
 			},
+			"context": schema.StringAttribute{
+				Description: "URL of a remote build context used instead of dir, e.g. a git repository such as \"https://github.com/org/repo.git#main:subdir\" or a tarball. The daemon fetches the context itself.",
+				Optional:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
 			"created": schema.StringAttribute{
 				Description: "Timestamp when the image was first built. Adding new tags does not update this value.",
 				Computed:    true,
@@ -93,22 +137,123 @@ func (r *imageResource) Schema(_ context.Context, _ resource.SchemaRequest, resp
 					stringplanmodifier.UseStateForUnknown(),
 				},
 			},
+			"repo_digest": schema.StringAttribute{
+				Description: "Repository digest of the image, e.g. \"registry.example.com/app@sha256:...\", once it has been pushed or pulled. Preferred to tags for pinning the image in other resources. Refreshed when the image is read.",
+				Computed:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"size_bytes": schema.Int64Attribute{
+				Description: "Size of the image in bytes.",
+				Computed:    true,
+				PlanModifiers: []planmodifier.Int64{
+					int64planmodifier.UseStateForUnknown(),
+				},
+			},
+			"architecture": schema.StringAttribute{
+				Description: "CPU architecture of the image, e.g. \"amd64\" or \"arm64\".",
+				Computed:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"os": schema.StringAttribute{
+				Description: "Operating system of the image, e.g. \"linux\".",
+				Computed:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"variant": schema.StringAttribute{
+				Description: "Variant of the CPU architecture of the image, e.g. \"v8\" for arm64. Empty if the architecture has no variants.",
+				Computed:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"image_config": schema.SingleNestedAttribute{
+				Description: "Configuration of the image that its containers inherit. Refreshed when the image is read.",
+				Computed:    true,
+				Attributes: map[string]schema.Attribute{
+					"labels": schema.MapAttribute{
+						Description: "Labels of the image, including those of its base images.",
+						ElementType: types.StringType,
+						Computed:    true,
+					},
+					"env": schema.ListAttribute{
+						Description: "Environment variables of the image, as KEY=VALUE.",
+						ElementType: types.StringType,
+						Computed:    true,
+					},
+					"entrypoint": schema.ListAttribute{
+						Description: "Entrypoint of the image.",
+						ElementType: types.StringType,
+						Computed:    true,
+					},
+					"cmd": schema.ListAttribute{
+						Description: "Default command of the image.",
+						ElementType: types.StringType,
+						Computed:    true,
+					},
+					"exposed_ports": schema.ListAttribute{
+						Description: "Ports exposed by the image, e.g. \"80/tcp\".",
+						ElementType: types.StringType,
+						Computed:    true,
+					},
+					"working_dir": schema.StringAttribute{
+						Description: "Working directory of the image.",
+						Computed:    true,
+					},
+				},
+				PlanModifiers: []planmodifier.Object{
+					objectplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"context_hash": schema.StringAttribute{
+				Description: "SHA256 of the build context, Dockerfile name and build arguments. The image is rebuilt when it changes, e.g. when a source file is edited.",
+				Computed:    true,
+			},
+			"build_log": schema.StringAttribute{
+				Description: "Output of the build, limited to its last 64 KiB.",
+				Computed:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
 			"dockerfile_name": schema.StringAttribute{
-				Description: "Name of the Dockerfile if a unique name is used.",
+				Description: "Name of the Dockerfile if a unique name is used, relative to dir, e.g. \"Dockerfile.prod\". The Dockerfile may be outside of dir, e.g. \"../docker/Dockerfile\" or an absolute path, in which case it is added to the build context under a name of its own.",
+				Optional:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"dockerfile_content": schema.StringAttribute{
+				Description: "Content of the Dockerfile, added to the build context as dockerfile_name instead of reading it from dir.",
 				Optional:    true,
 				PlanModifiers: []planmodifier.String{
 					stringplanmodifier.RequiresReplace(),
 				},
 			},
 			"platform": schema.StringAttribute{
-				Description: "Set platform of the build output.",
+				Description: "Set platform of the build output, e.g. linux/amd64. Defaults to the platform of the Docker daemon.",
+				Optional:    true,
+				Validators: []validator.String{
+					platformValidator{},
+				},
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"output_path": schema.StringAttribute{
+				Description: "Path of a tar archive to which the image is saved after it is built, as with docker save. The archive can be loaded with docker load, e.g. on a host without access to a registry.",
 				Optional:    true,
 				PlanModifiers: []planmodifier.String{
 					stringplanmodifier.RequiresReplace(),
 				},
 			},
 			"nocache": schema.BoolAttribute{
-				Description: "Specify whether to use cache when building the image.",
+				Description: "Specify whether to build without the build cache. Defaults to true.",
 				Optional:    true,
 				PlanModifiers: []planmodifier.Bool{
 					boolplanmodifier.RequiresReplace(),
@@ -121,120 +266,1101 @@ func (r *imageResource) Schema(_ context.Context, _ resource.SchemaRequest, resp
 					boolplanmodifier.RequiresReplace(),
 				},
 			},
+			"remove": schema.BoolAttribute{
+				Description: "Remove intermediate containers after a successful build. Defaults to true. Set to false to inspect them when debugging a build.",
+				Optional:    true,
+				PlanModifiers: []planmodifier.Bool{
+					boolplanmodifier.RequiresReplace(),
+				},
+			},
+			"prune_on_cancel": schema.BoolAttribute{
+				Description: "Remove dangling images, such as the layers of a partial build, when the build is cancelled by interrupting the apply.",
+				Optional:    true,
+			},
+			"force_remove": schema.BoolAttribute{
+				Description: "Always remove intermediate containers, even if the build fails.",
+				Optional:    true,
+				PlanModifiers: []planmodifier.Bool{
+					boolplanmodifier.RequiresReplace(),
+				},
+			},
+			"builder": schema.StringAttribute{
+				Description: "Builder to use: \"buildkit\" or \"classic\" for the builders of the daemon, or the name of a builder created with docker buildx create using the docker-container, kubernetes or remote driver. Images built by a buildx builder are loaded into the daemon. Defaults to BuildKit if the daemon supports it. BuildKit is required for cache mounts and build secrets.",
+				Optional:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"buildkit_host": schema.StringAttribute{
+				Description: "Address of a standalone BuildKit daemon to build with instead of the Docker daemon, e.g. \"tcp://buildkit:1234\", \"unix:///run/buildkit/buildkitd.sock\" or \"kube-pod://buildkitd-0?namespace=buildkit\". The image is loaded into the Docker daemon once built. Cannot be combined with builder.",
+				Optional:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"target": schema.StringAttribute{
+				Description: "Stage of a multi-stage Dockerfile to build, e.g. \"runtime\". Defaults to the last stage.",
+				Optional:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"network_mode": schema.StringAttribute{
+				Description: "Network of the containers running RUN instructions, e.g. \"host\", \"none\" or the name of a network. Defaults to the default bridge network.",
+				Optional:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"extra_hosts": schema.ListAttribute{
+				Description: "Entries added to /etc/hosts of the containers running RUN instructions, in the format host:ip, e.g. \"artifactory.internal:10.1.2.3\".",
+				ElementType: types.StringType,
+				Optional:    true,
+				PlanModifiers: []planmodifier.List{
+					listplanmodifier.RequiresReplace(),
+				},
+			},
+			"isolation": schema.StringAttribute{
+				Description: "Isolation of the containers running RUN instructions on Windows daemons, either \"process\" or \"hyperv\". Defaults to the isolation configured on the daemon.",
+				Optional:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+				Validators: []validator.String{
+					oneOfValidator{values: []string{string(container.IsolationProcess), string(container.IsolationHyperV)}},
+				},
+			},
+			"build_args": schema.MapAttribute{
+				Description: "Build arguments for ARG instructions of the Dockerfile. Take precedence over build_arg_files.",
+				ElementType: types.StringType,
+				Optional:    true,
+				PlanModifiers: []planmodifier.Map{
+					mapplanmodifier.RequiresReplace(),
+				},
+			},
+			"build_arg_files": schema.ListAttribute{
+				Description: "Paths of dotenv-style files of build arguments, e.g. the env_file of compose. Files later in the list take precedence over earlier ones. The image is rebuilt when their content changes.",
+				ElementType: types.StringType,
+				Optional:    true,
+				PlanModifiers: []planmodifier.List{
+					listplanmodifier.RequiresReplace(),
+				},
+			},
+			"excludes": schema.ListAttribute{
+				Description: "Patterns of files to leave out of the build context, in the syntax of .dockerignore, e.g. \".terraform/\" or \"dist/**\". Applied in addition to the .dockerignore of dir.",
+				ElementType: types.StringType,
+				Optional:    true,
+				PlanModifiers: []planmodifier.List{
+					listplanmodifier.RequiresReplace(),
+				},
+			},
+			"cache_from": schema.ListAttribute{
+				Description: "Images to use as cache sources, e.g. previously pushed tags of this image. With BuildKit, the images must have been built with cache metadata, e.g. an inline cache. The classic builder only uses images that are present locally. Requires nocache = false.",
+				ElementType: types.StringType,
+				Optional:    true,
+				PlanModifiers: []planmodifier.List{
+					listplanmodifier.RequiresReplace(),
+				},
+			},
+			"cache_to": schema.ListAttribute{
+				Description: "Cache exporters in the syntax of docker buildx build --cache-to, e.g. \"type=inline\" to embed cache metadata in the image so that later builds can use it with cache_from once it is pushed, \"type=registry,ref=registry.local:5000/app:buildcache,mode=max\" to push the cache to a registry of its own or \"type=local,dest=/tmp/buildcache\" to write it to a directory. Requires BuildKit. The BuildKit of the daemon only exports type=inline caches: the other types require buildkit_host or a buildx builder with the docker-container, kubernetes or remote driver.",
+				ElementType: types.StringType,
+				Optional:    true,
+				PlanModifiers: []planmodifier.List{
+					listplanmodifier.RequiresReplace(),
+				},
+			},
+			"inline_cache": schema.BoolAttribute{
+				Description: "Embed cache metadata in the image, the same as cache_to = [\"type=inline\"], so that later builds can use the image with cache_from once it is pushed, without a separate cache registry. Requires BuildKit.",
+				Optional:    true,
+				PlanModifiers: []planmodifier.Bool{
+					boolplanmodifier.RequiresReplace(),
+				},
+			},
+			"triggers": schema.MapAttribute{
+				Description: "Arbitrary values that rebuild the image when they change, e.g. a git commit SHA or a hash of files outside of dir.",
+				ElementType: types.StringType,
+				Optional:    true,
+				PlanModifiers: []planmodifier.Map{
+					mapplanmodifier.RequiresReplace(),
+				},
+			},
+			"pull_triggers": schema.SetAttribute{
+				Description: "Values that pull the image again when they change, e.g. the digest of the remote image from the docker_image data source, so that a moved tag is pulled. Requires pull.",
+				ElementType: types.StringType,
+				Optional:    true,
+				PlanModifiers: []planmodifier.Set{
+					setplanmodifier.RequiresReplace(),
+				},
+			},
+			"labels": schema.MapAttribute{
+				Description: "Labels to set on the built image, e.g. the git commit or pipeline ID it was built from. The provider also sets the label " + buildHashLabel + " to a hash of the context and configuration of the build, with which an image built by an apply that failed is reused instead of built again if nocache is false and the context is local.",
+				ElementType: types.StringType,
+				Optional:    true,
+				PlanModifiers: []planmodifier.Map{
+					mapplanmodifier.RequiresReplace(),
+				},
+			},
+			"base_images": schema.ListNestedAttribute{
+				Description: "Base images referenced by FROM lines in the Dockerfile, pinned to a digest. The FROM lines are rewritten to reference these digests, so that the build uses exactly these images.",
+				Optional:    true,
+				PlanModifiers: []planmodifier.List{
+					listplanmodifier.RequiresReplace(),
+				},
+				NestedObject: schema.NestedAttributeObject{
+					Attributes: map[string]schema.Attribute{
+						"reference": schema.StringAttribute{
+							Description: "Image reference as written in the FROM line, e.g. golang:1.22.",
+							Required:    true,
+						},
+						"digest": schema.StringAttribute{
+							Description: "Expected digest of the image, e.g. sha256:6a5e....",
+							Required:    true,
+						},
+					},
+				},
+			},
+			"rebuild_on_base_update": schema.BoolAttribute{
+				Description: "Check the registry for new digests of the base images in base_image_digests when planning, and rebuild the image if any of them moved, e.g. to a new patch release of alpine:3.20. The base images are resolved from their registry and pinned to a digest for the build, so base images built or tagged locally are only used if they have not been pushed. Base images are tracked from the next build of the image.",
+				Optional:    true,
+			},
+			"base_image_digests": schema.MapAttribute{
+				Description: "Digests of the base images referenced by FROM lines in the Dockerfile that the build was pinned to, keyed by reference. Only set if base_images or rebuild_on_base_update is set. With rebuild_on_base_update, base images that are not referenced by digest are resolved from their registry before the build; those only available in the daemon are left out.",
+				ElementType: types.StringType,
+				Computed:    true,
+				PlanModifiers: []planmodifier.Map{
+					mapplanmodifier.UseStateForUnknown(),
+				},
+			},
+		},
+		Blocks: map[string]schema.Block{
+			"secrets": schema.ListNestedBlock{
+				Description: "Secrets made available to RUN --mount=type=secret,id=<id> during the build, without being stored in the image. Requires BuildKit.",
+				PlanModifiers: []planmodifier.List{
+					listplanmodifier.RequiresReplace(),
+				},
+				NestedObject: schema.NestedBlockObject{
+					Attributes: map[string]schema.Attribute{
+						"id": schema.StringAttribute{
+							Description: "ID of the secret, as referenced by the Dockerfile.",
+							Required:    true,
+						},
+						"source": schema.StringAttribute{
+							Description: "Path of a file holding the secret.",
+							Optional:    true,
+						},
+						"value": schema.StringAttribute{
+							Description: "Value of the secret, if source is not set.",
+							Optional:    true,
+							Sensitive:   true,
+						},
+					},
+				},
+			},
+			"pull": schema.SingleNestedBlock{
+				Description: "Pulls the image from a registry instead of building it, using the credentials of the provider. Cannot be combined with the attributes that configure a build, such as dir or context.",
+				PlanModifiers: []planmodifier.Object{
+					objectplanmodifier.RequiresReplace(),
+				},
+				Attributes: map[string]schema.Attribute{
+					"reference": schema.StringAttribute{
+						Description: "Reference of the image to pull, e.g. \"nginx:1.27\" or \"nginx@sha256:...\". The image is pulled for platform if set.",
+						Optional:    true,
+					},
+				},
+			},
+			"output": schema.SingleNestedBlock{
+				Description: "Writes the result of the build to disk instead of storing it as an image in the daemon. Requires BuildKit.",
+				PlanModifiers: []planmodifier.Object{
+					objectplanmodifier.RequiresReplace(),
+				},
+				Attributes: map[string]schema.Attribute{
+					"type": schema.StringAttribute{
+						Description: "Exporter to use: \"local\" for the filesystem of the image in a directory, \"tar\" for the filesystem as a tarball, \"oci\" for an OCI image layout tarball or \"docker\" for a tarball that can be loaded with docker load. The daemon only supports oci and docker with the containerd image store.",
+						Required:    true,
+						Validators: []validator.String{
+							oneOfValidator{values: []string{"local", "tar", "oci", "docker"}},
+						},
+					},
+					"dest": schema.StringAttribute{
+						Description: "Path of the directory or tarball to write.",
+						Required:    true,
+					},
+				},
+			},
+			"buildkit_tls": schema.SingleNestedBlock{
+				Description: "TLS configuration for a buildkit_host listening on TCP.",
+				PlanModifiers: []planmodifier.Object{
+					objectplanmodifier.RequiresReplace(),
+				},
+				Attributes: map[string]schema.Attribute{
+					"ca_cert": schema.StringAttribute{
+						Description: "Path of the CA certificate to verify the BuildKit daemon with. Defaults to the system CAs.",
+						Optional:    true,
+					},
+					"cert": schema.StringAttribute{
+						Description: "Path of the client certificate.",
+						Optional:    true,
+					},
+					"key": schema.StringAttribute{
+						Description: "Path of the key of the client certificate.",
+						Optional:    true,
+					},
+					"server_name": schema.StringAttribute{
+						Description: "Server name to verify the certificate of the BuildKit daemon against. Defaults to the host of buildkit_host.",
+						Optional:    true,
+					},
+				},
+			},
+			"timeouts": schema.SingleNestedBlock{
+				Description: "Timeouts of this image, e.g. \"30m\". Unset timeouts are inherited from the timeouts block of the provider.",
+				Attributes: map[string]schema.Attribute{
+					"build": schema.StringAttribute{
+						Description: "Timeout for building the image, including pulling its base images.",
+						Optional:    true,
+					},
+					"delete": schema.StringAttribute{
+						Description: "Timeout for removing the image.",
+						Optional:    true,
+					},
+				},
+			},
 		},
 	}
 }
 
 type imageResourceModel struct {
-	ID             types.String `tfsdk:"id"`
-	Tags           []tagModel   `tfsdk:"tags"`
-	Dir            types.String `tfsdk:"dir"`
-	Created        types.String `tfsdk:"created"`
-	DockerFileName types.String `tfsdk:"dockerfile_name"`
-	Platform       types.String `tfsdk:"platform"`
-	NoCache        types.Bool   `tfsdk:"nocache"`
-	PullParent     types.Bool   `tfsdk:"pullparent"`
+	ID                types.String        `tfsdk:"id"`
+	Tags              []tagModel          `tfsdk:"tags"`
+	Dir               types.String        `tfsdk:"dir"`
+	RemoteContext     types.String        `tfsdk:"context"`
+	Created           types.String        `tfsdk:"created"`
+	RepoDigest        types.String        `tfsdk:"repo_digest"`
+	SizeBytes         types.Int64         `tfsdk:"size_bytes"`
+	Architecture      types.String        `tfsdk:"architecture"`
+	ImageConfig       types.Object        `tfsdk:"image_config"`
+	OS                types.String        `tfsdk:"os"`
+	Variant           types.String        `tfsdk:"variant"`
+	ContextHash       types.String        `tfsdk:"context_hash"`
+	BuildLog          types.String        `tfsdk:"build_log"`
+	DockerFileName    types.String        `tfsdk:"dockerfile_name"`
+	DockerFileContent types.String        `tfsdk:"dockerfile_content"`
+	Platform          types.String        `tfsdk:"platform"`
+	OutputPath        types.String        `tfsdk:"output_path"`
+	NoCache           types.Bool          `tfsdk:"nocache"`
+	PullParent        types.Bool          `tfsdk:"pullparent"`
+	Remove            types.Bool          `tfsdk:"remove"`
+	ForceRemove       types.Bool          `tfsdk:"force_remove"`
+	PruneOnCancel     types.Bool          `tfsdk:"prune_on_cancel"`
+	Builder           types.String        `tfsdk:"builder"`
+	BuildKitHost      types.String        `tfsdk:"buildkit_host"`
+	BuildKitTLS       *buildKitTLSModel   `tfsdk:"buildkit_tls"`
+	Target            types.String        `tfsdk:"target"`
+	NetworkMode       types.String        `tfsdk:"network_mode"`
+	ExtraHosts        []string            `tfsdk:"extra_hosts"`
+	Isolation         types.String        `tfsdk:"isolation"`
+	Excludes          []string            `tfsdk:"excludes"`
+	BuildArgs         types.Map           `tfsdk:"build_args"`
+	BuildArgFiles     []string            `tfsdk:"build_arg_files"`
+	CacheFrom         []string            `tfsdk:"cache_from"`
+	CacheTo           []string            `tfsdk:"cache_to"`
+	InlineCache       types.Bool          `tfsdk:"inline_cache"`
+	Triggers          types.Map           `tfsdk:"triggers"`
+	PullTriggers      types.Set           `tfsdk:"pull_triggers"`
+	Overwrite         types.Bool          `tfsdk:"overwrite"`
+	Labels            types.Map           `tfsdk:"labels"`
+	BaseImages        []baseImageModel    `tfsdk:"base_images"`
+	BaseImageDigests  types.Map           `tfsdk:"base_image_digests"`
+	RebuildOnBase     types.Bool          `tfsdk:"rebuild_on_base_update"`
+	Secrets           []buildSecretModel  `tfsdk:"secrets"`
+	Pull              *pullModel          `tfsdk:"pull"`
+	Output            *buildOutputModel   `tfsdk:"output"`
+	Timeouts          *imageTimeoutsModel `tfsdk:"timeouts"`
 	// Size    types.Int64  `tfsdk:"size"`
 }
 
+type imageTimeoutsModel struct {
+	Build  types.String `tfsdk:"build"`
+	Delete types.String `tfsdk:"delete"`
+}
+
+// build returns the build timeout of the timeouts block, which may be unset.
+func (m *imageTimeoutsModel) build() types.String {
+	if m == nil {
+		return types.StringNull()
+	}
+	return m.Build
+}
+
+// delete returns the delete timeout of the timeouts block, which may be unset.
+func (m *imageTimeoutsModel) delete() types.String {
+	if m == nil {
+		return types.StringNull()
+	}
+	return m.Delete
+}
+
+type buildSecretModel struct {
+	ID     types.String `tfsdk:"id"`
+	Source types.String `tfsdk:"source"`
+	Value  types.String `tfsdk:"value"`
+}
+
+type buildKitTLSModel struct {
+	CACert     types.String `tfsdk:"ca_cert"`
+	Cert       types.String `tfsdk:"cert"`
+	Key        types.String `tfsdk:"key"`
+	ServerName types.String `tfsdk:"server_name"`
+}
+
+type pullModel struct {
+	Reference types.String `tfsdk:"reference"`
+}
+
+type buildOutputModel struct {
+	Type types.String `tfsdk:"type"`
+	Dest types.String `tfsdk:"dest"`
+}
+
+type baseImageModel struct {
+	Reference types.String `tfsdk:"reference"`
+	Digest    types.String `tfsdk:"digest"`
+}
+
 type tagModel struct {
 	Repository types.String `tfsdk:"repository"`
 	Tag        types.String `tfsdk:"tag"`
 }
 
-// Create creates the resource and sets the initial Terraform state.
-func (r *imageResource) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
-	var plan imageResourceModel
-	diags := req.Plan.Get(ctx, &plan)
-	resp.Diagnostics.Append(diags...)
-	if resp.Diagnostics.HasError() {
-		return
+// ValidateConfig rejects attributes that cannot be used together, so that
+// they are reported when planning rather than when the image is built.
+func (r *imageResource) ValidateConfig(ctx context.Context, req resource.ValidateConfigRequest, resp *resource.ValidateConfigResponse) {
+	set := func(attributePath path.Path) bool {
+		set, _ := configAttribute(ctx, req.Config, attributePath)
+		return set
+	}
+	unset := func(attributePath path.Path) bool {
+		set, known := configAttribute(ctx, req.Config, attributePath)
+		return known && !set
 	}
 
-	// Defaults if not declared in terraform plan
-	dir := "."
-	if plan.Dir.ValueString() != "" {
-		dir = plan.Dir.ValueString()
+	if set(path.Root("pull")) {
+		for _, name := range pullConflictingAttributes {
+			if set(path.Root(name)) {
+				resp.Diagnostics.AddAttributeError(
+					path.Root(name),
+					"Invalid pull",
+					name+" cannot be used with pull, as the image is not built.",
+				)
+			}
+		}
 	}
 
-	dockerFile := "Dockerfile"
-	if plan.DockerFileName.ValueString() != "" {
-		dockerFile = plan.DockerFileName.ValueString()
+	if set(path.Root("context")) && set(path.Root("dir")) {
+		resp.Diagnostics.AddAttributeError(
+			path.Root("context"),
+			"Invalid build context",
+			"context and dir cannot both be set.",
+		)
 	}
 
-	platform := "linux/arm64"
-	if plan.Platform.ValueString() != "" {
-		platform = plan.Platform.ValueString()
+	if set(path.Root("context")) && set(path.Root("dockerfile_content")) {
+		resp.Diagnostics.AddAttributeError(
+			path.Root("dockerfile_content"),
+			"Invalid build context",
+			"dockerfile_content cannot be used with a remote context.",
+		)
 	}
 
-	// Builds Image
-	buildResponse, err := imageBuild(r, ctx, dir, dockerFile, plan.Tags, platform)
+	// The Dockerfile of a remote context is only read by the daemon
+	if set(path.Root("context")) && set(path.Root("base_images")) {
+		resp.Diagnostics.AddAttributeError(
+			path.Root("base_images"),
+			"Invalid build context",
+			"base_images cannot be verified for a remote context.",
+		)
+	}
 
-	if err != nil {
-		tflog.Debug(ctx, "Unable to build docker image")
-		tflog.Debug(ctx, err.Error())
+	if set(path.Root("output_path")) && set(path.Root("output")) {
+		resp.Diagnostics.AddAttributeError(
+			path.Root("output_path"),
+			"Invalid output",
+			"output_path cannot be used with an output block, as the image is not stored in the daemon.",
+		)
 	}
-	defer buildResponse.Body.Close()
 
-	// Check if build response can be parsed
-	result, parseErr := parseDockerDaemonJsonMessages(buildResponse.Body)
-	if parseErr != nil {
-		tflog.Debug(ctx, "Unable to read image build response")
-		fmt.Println(parseErr.Error())
-	} else {
-		tflog.Debug(ctx, "Successfully read image build response")
-		fmt.Printf("%+v\n", "Build Response is: ")
-		fmt.Printf("%+v\n", result)
+	if set(path.Root("buildkit_host")) && set(path.Root("builder")) {
+		resp.Diagnostics.AddAttributeError(
+			path.Root("buildkit_host"),
+			"Invalid builder",
+			"buildkit_host and builder cannot both be set.",
+		)
+	}
 
-		// Map response body to schema and populate Computed attribute values
-		imageInspect, _, err := r.client.ImageInspectWithRaw(ctx, types.StringValue(result.ID).ValueString())
-		if err != nil {
-			// resp.Diagnostics.AddError(
-			// 	"Error Reading Image",
-			// 	"Could not read Image ID "+state.ID.ValueString()+": "+err.Error(),
-			// )
+	if set(path.Root("buildkit_tls")) && unset(path.Root("buildkit_host")) {
+		resp.Diagnostics.AddAttributeError(
+			path.Root("buildkit_tls"),
+			"Invalid BuildKit TLS configuration",
+			"buildkit_tls requires buildkit_host.",
+		)
+	}
 
-			resp.State.RemoveResource(ctx)
-			return
-		}
+	cert := path.Root("buildkit_tls").AtName("cert")
+	key := path.Root("buildkit_tls").AtName("key")
+	if (set(cert) && unset(key)) || (set(key) && unset(cert)) {
+		resp.Diagnostics.AddAttributeError(
+			path.Root("buildkit_tls"),
+			"Invalid BuildKit TLS configuration",
+			"cert and key must be set together.",
+		)
+	}
 
-		plan.ID = types.StringValue(imageInspect.ID)
-		plan.Created = types.StringValue(imageInspect.Created)
+	if set(path.Root("pull_triggers")) && unset(path.Root("pull")) {
+		resp.Diagnostics.AddAttributeError(
+			path.Root("pull_triggers"),
+			"Invalid pull",
+			"pull_triggers requires pull.",
+		)
+	}
+}
 
-		// Gets each tag, puts it into tagModel{} and appends to state.Tags
-		plan.Tags = []tagModel{}
-		for _, item := range imageInspect.RepoTags {
-			repotagSplit := strings.Split(item, ":")
+// pullConflictingAttributes are the attributes that configure a build, which
+// cannot be used with pull. They are in schema order, so that the diagnostics
+// are reported in a stable order.
+var pullConflictingAttributes = []string{
+	"dir", "context", "dockerfile_name", "dockerfile_content", "output_path",
+	"nocache", "pullparent", "remove", "force_remove", "prune_on_cancel",
+	"builder", "buildkit_host", "target", "network_mode", "extra_hosts",
+	"isolation", "excludes", "build_args", "build_arg_files", "cache_from",
+	"cache_to", "inline_cache", "labels", "base_images",
+	"rebuild_on_base_update", "secrets", "output", "buildkit_tls",
+}
 
-			plan.Tags = append(plan.Tags, tagModel{
-				Repository: types.StringValue(repotagSplit[0]),
-				Tag:        types.StringValue(repotagSplit[1]),
-			})
-		}
+// configAttribute reports whether the attribute at attributePath is set in
+// config to something other than null, an empty string or an empty
+// collection, and whether that is known yet. Unknown values are checked once
+// they are known, as the configuration is validated again before it is
+// applied.
+func configAttribute(ctx context.Context, config tfsdk.Config, attributePath path.Path) (set bool, known bool) {
+	var value attr.Value
+	diags := config.GetAttribute(ctx, attributePath, &value)
+	if diags.HasError() || value == nil || value.IsNull() {
+		return false, true
+	}
+	if value.IsUnknown() {
+		return false, false
 	}
 
-	// Set state to fully populated data
-	diags = resp.State.Set(ctx, &plan)
+	switch value := value.(type) {
+	case types.String:
+		return value.ValueString() != "", true
+	case types.List:
+		return len(value.Elements()) > 0, true
+	case types.Set:
+		return len(value.Elements()) > 0, true
+	case types.Map:
+		return len(value.Elements()) > 0, true
+	}
 
-	resp.Diagnostics.Append(diags...)
+	return true, true
+}
+
+// ModifyPlan computes the context_hash of the build context and replaces the
+// image if it differs from the one the image was built from.
+func (r *imageResource) ModifyPlan(ctx context.Context, req resource.ModifyPlanRequest, resp *resource.ModifyPlanResponse) {
+	// Nothing to build when the image is destroyed
+	if req.Plan.Raw.IsNull() {
+		return
+	}
+
+	// Pulled images have no build context
+	var pull types.Object
+	resp.Diagnostics.Append(req.Plan.GetAttribute(ctx, path.Root("pull"), &pull)...)
+	if !pull.IsNull() {
+		resp.Diagnostics.Append(resp.Plan.SetAttribute(ctx, path.Root("context_hash"), types.StringNull())...)
+		return
+	}
+
+	r.planBaseImageUpdates(ctx, req, resp)
 	if resp.Diagnostics.HasError() {
 		return
 	}
-}
 
-// Read refreshes the Terraform state with the latest data.
-func (r *imageResource) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
-	// Get current state
-	var state imageResourceModel
-	diags := req.State.Get(ctx, &state)
-	resp.Diagnostics.Append(diags...)
+	var dir, remoteContext, dockerFileName, dockerFileContent types.String
+	var cacheTo, buildArgFiles, excludes types.List
+	var planBuildArgs types.Map
+	var inlineCache types.Bool
+	resp.Diagnostics.Append(req.Plan.GetAttribute(ctx, path.Root("dir"), &dir)...)
+	resp.Diagnostics.Append(req.Plan.GetAttribute(ctx, path.Root("context"), &remoteContext)...)
+	resp.Diagnostics.Append(req.Plan.GetAttribute(ctx, path.Root("dockerfile_name"), &dockerFileName)...)
+	resp.Diagnostics.Append(req.Plan.GetAttribute(ctx, path.Root("dockerfile_content"), &dockerFileContent)...)
+	resp.Diagnostics.Append(req.Plan.GetAttribute(ctx, path.Root("cache_to"), &cacheTo)...)
+	resp.Diagnostics.Append(req.Plan.GetAttribute(ctx, path.Root("inline_cache"), &inlineCache)...)
+	resp.Diagnostics.Append(req.Plan.GetAttribute(ctx, path.Root("build_args"), &planBuildArgs)...)
+	resp.Diagnostics.Append(req.Plan.GetAttribute(ctx, path.Root("build_arg_files"), &buildArgFiles)...)
+	resp.Diagnostics.Append(req.Plan.GetAttribute(ctx, path.Root("excludes"), &excludes)...)
 	if resp.Diagnostics.HasError() {
 		return
 	}
 
-	// Returns the image information and its raw representation.
-	imageInspect, _, err := r.client.ImageInspectWithRaw(ctx, state.ID.ValueString())
-	if err != nil {
+	// The context may not exist yet, e.g. if it is generated by another
+	// resource, in which case the hash is computed when the image is built
+	if dir.IsUnknown() || remoteContext.IsUnknown() || dockerFileName.IsUnknown() || dockerFileContent.IsUnknown() || cacheTo.IsUnknown() || inlineCache.IsUnknown() || planBuildArgs.IsUnknown() || buildArgFiles.IsUnknown() || excludes.IsUnknown() {
+		return
+	}
+
+	contextDir := "."
+	if dir.ValueString() != "" {
+		contextDir = dir.ValueString()
+	}
+	if _, err := os.Stat(contextDir); err != nil && remoteContext.ValueString() == "" {
+		return
+	}
+
+	planExcludes := []string{}
+	resp.Diagnostics.Append(excludes.ElementsAs(ctx, &planExcludes, false)...)
+	planCacheTo := []string{}
+	resp.Diagnostics.Append(cacheTo.ElementsAs(ctx, &planCacheTo, false)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if inlineCache.ValueBool() {
+		planCacheTo = append(planCacheTo, "type=inline")
+	}
+
+	planBuildArgValues := map[string]types.String{}
+	resp.Diagnostics.Append(planBuildArgs.ElementsAs(ctx, &planBuildArgValues, false)...)
+	planBuildArgFiles := []types.String{}
+	resp.Diagnostics.Append(buildArgFiles.ElementsAs(ctx, &planBuildArgFiles, false)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	buildArgValues := map[string]string{}
+	for key, value := range planBuildArgValues {
+		if value.IsUnknown() {
+			return
+		}
+		buildArgValues[key] = value.ValueString()
+	}
+	buildArgFileNames := []string{}
+	for _, name := range planBuildArgFiles {
+		if name.IsUnknown() {
+			return
+		}
+		buildArgFileNames = append(buildArgFileNames, name.ValueString())
+	}
+
+	// Build argument files may not exist yet either
+	buildArgs, err := mergeBuildArgs(buildArgFileNames, buildArgValues)
+	if err != nil {
+		return
+	}
+
+	// Invalid exporters are reported when the image is built
+	cacheExports, _ := parseCacheExporters(planCacheTo)
+	maps.Copy(buildArgs, cacheExportBuildArgs(cacheExports))
+
+	// context_hash is left unknown, so the image is built again and the
+	// build reports the error if the context is still unreadable
+	contextHash, err := buildContextHash(ctx, contextDir, remoteContext.ValueString(), dockerFileName.ValueString(), dockerFileContent.ValueString(), planExcludes, buildArgs)
+	if err != nil {
+		resp.Diagnostics.AddAttributeWarning(
+			path.Root("dir"),
+			"Unable to hash build context",
+			"Could not read build context "+contextDir+", so whether the image changed is known after apply: "+err.Error(),
+		)
+		return
+	}
+	resp.Diagnostics.Append(resp.Plan.SetAttribute(ctx, path.Root("context_hash"), contextHash)...)
+
+	if req.State.Raw.IsNull() {
+		return
+	}
+
+	var stateContextHash types.String
+	resp.Diagnostics.Append(req.State.GetAttribute(ctx, path.Root("context_hash"), &stateContextHash)...)
+	if !stateContextHash.IsNull() && stateContextHash.ValueString() != contextHash {
+		resp.RequiresReplace = append(resp.RequiresReplace, path.Root("context_hash"))
+	}
+}
+
+// planBaseImageUpdates replaces the image if rebuild_on_base_update is set and
+// the registry has a new digest for any of the base images it was built from.
+// The rebuild is pinned to the digests that the registry then serves.
+func (r *imageResource) planBaseImageUpdates(ctx context.Context, req resource.ModifyPlanRequest, resp *resource.ModifyPlanResponse) {
+	if req.State.Raw.IsNull() || r.client == nil {
+		return
+	}
+
+	var rebuildOnBase types.Bool
+	var stateDigests types.Map
+	var baseImages []baseImageModel
+	resp.Diagnostics.Append(req.Plan.GetAttribute(ctx, path.Root("rebuild_on_base_update"), &rebuildOnBase)...)
+	resp.Diagnostics.Append(req.State.GetAttribute(ctx, path.Root("base_image_digests"), &stateDigests)...)
+	resp.Diagnostics.Append(req.Plan.GetAttribute(ctx, path.Root("base_images"), &baseImages)...)
+	if resp.Diagnostics.HasError() || !rebuildOnBase.ValueBool() || stateDigests.IsNull() {
+		return
+	}
+
+	digests := map[string]string{}
+	resp.Diagnostics.Append(stateDigests.ElementsAs(ctx, &digests, false)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	references := []string{}
+	for reference := range digests {
+		references = append(references, reference)
+	}
+	slices.Sort(references)
+
+	moved := []string{}
+	for _, reference := range references {
+		// Images pinned by digest in the Dockerfile or base_images never move
+		if _, _, err := splitRepoDigest(reference); err == nil {
+			continue
+		}
+		if slices.ContainsFunc(baseImages, func(baseImage baseImageModel) bool { return baseImage.Reference.ValueString() == reference }) {
+			continue
+		}
+
+		digest, err := registryDigest(r, ctx, reference)
+		if err != nil {
+			resp.Diagnostics.AddWarning(
+				"Unable to check base image for updates",
+				"Could not read the digest of base image "+reference+" from its registry, unexpected error: "+err.Error(),
+			)
+			continue
+		}
+		if digest != digests[reference] {
+			tflog.Info(ctx, "Base image moved", map[string]any{"reference": reference, "digest": digests[reference], "registry_digest": digest})
+			moved = append(moved, reference)
+		}
+	}
+
+	if len(moved) > 0 {
+		resp.Diagnostics.Append(resp.Plan.SetAttribute(ctx, path.Root("base_image_digests"), types.MapUnknown(types.StringType))...)
+		resp.RequiresReplace = append(resp.RequiresReplace, path.Root("base_image_digests"))
+	}
+}
+
+// Create creates the resource and sets the initial Terraform state.
+func (r *imageResource) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
+	var plan imageResourceModel
+	diags := req.Plan.Get(ctx, &plan)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := withOperationTimeout(ctx, plan.Timeouts.build(), path.Root("timeouts").AtName("build"), r.timeouts.build, &resp.Diagnostics)
+	defer cancel()
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	// Pull mode sources the image from a registry instead of building it
+	if plan.Pull != nil {
+		createPulledImage(r, ctx, &plan, &resp.Diagnostics)
+		if resp.Diagnostics.HasError() {
+			return
+		}
+
+		diags = resp.State.Set(ctx, &plan)
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+
+	// Defaults if not declared in terraform plan
+	dir := "."
+	if plan.Dir.ValueString() != "" {
+		dir = plan.Dir.ValueString()
+	}
+
+	dockerFile := "Dockerfile"
+	if plan.DockerFileName.ValueString() != "" {
+		dockerFile = plan.DockerFileName.ValueString()
+	}
+
+	// Builds for the platform of the daemon unless platform is set
+	platform := plan.Platform.ValueString()
+	if platform == "" {
+		detected, err := daemonPlatform(r, ctx)
+		if err != nil {
+			resp.Diagnostics.AddError(
+				"Unable to build Docker image",
+				"Could not detect platform of Docker daemon, unexpected error: "+err.Error(),
+			)
+			return
+		}
+		platform = detected
+	}
+
+	// A Dockerfile outside of dir is sent as if it were dockerfile_content
+	dockerFileContent := plan.DockerFileContent.ValueString()
+	var err error
+	if plan.RemoteContext.ValueString() == "" && dockerFileContent == "" {
+		dockerFile, dockerFileContent, err = outsideContextDockerfile(dir, dockerFile)
+		if err != nil {
+			resp.Diagnostics.AddAttributeError(
+				path.Root("dockerfile_name"),
+				"Unable to read Dockerfile",
+				"Could not read Dockerfile, unexpected error: "+err.Error(),
+			)
+			return
+		}
+	}
+
+	// base_images are checked against the FROM lines, which are pinned to
+	// their digests below
+	var baseImages []string
+	dockerFileSource := dockerFileContent
+	if plan.RemoteContext.ValueString() == "" && dockerFileSource == "" {
+		content, err := os.ReadFile(filepath.Join(dir, dockerFile))
+		if err != nil {
+			resp.Diagnostics.AddError(
+				"Unable to read Dockerfile",
+				"Could not read Dockerfile, unexpected error: "+err.Error(),
+			)
+			return
+		}
+		dockerFileSource = string(content)
+	}
+	if plan.RemoteContext.ValueString() == "" {
+		baseImages = parseDockerfileBaseImages(dockerFileSource)
+	}
+
+	for _, baseImage := range plan.BaseImages {
+		warning, err := insecureRegistryWarning(ctx, r.client, r.insecureRegistries, baseImage.Reference.ValueString())
+		if err != nil {
+			tflog.Debug(ctx, "Unable to check insecure registry configuration of the daemon: "+err.Error())
+		}
+		if warning != "" {
+			resp.Diagnostics.AddWarning("Insecure registry not configured on the Docker daemon", warning)
+		}
+	}
+
+	plan.BaseImageDigests = types.MapNull(types.StringType)
+
+	// With base_images or rebuild_on_base_update, the Dockerfile sent to the
+	// builder references the base images by digest, so that
+	// base_image_digests records the images the build uses rather than the
+	// ones the builder resolves their tags to. Otherwise it is sent as is,
+	// so that base images built or tagged locally are used.
+	var baseImageDigests map[string]string
+	if len(plan.BaseImages) > 0 || plan.RebuildOnBase.ValueBool() {
+		baseImageDigests, err = resolveBaseImageDigests(r, ctx, plan.BaseImages, baseImages, plan.RebuildOnBase.ValueBool())
+		if err != nil {
+			resp.Diagnostics.AddAttributeError(
+				path.Root("base_images"),
+				"Unable to verify base image",
+				"Could not verify base image: "+err.Error(),
+			)
+			return
+		}
+		if len(baseImageDigests) > 0 {
+			dockerFileContent = pinDockerfileBaseImages(dockerFileSource, baseImageDigests)
+		}
+	}
+
+	if builder := plan.Builder.ValueString(); builder != "" && builder != builderBuildKit && builder != builderClassic {
+		if _, err := loadBuildxBuilder(r.configDir, builder); err != nil {
+			resp.Diagnostics.AddAttributeError(
+				path.Root("builder"),
+				"Invalid builder",
+				"builder must be \""+builderBuildKit+"\", \""+builderClassic+"\" or the name of a buildx builder: "+err.Error(),
+			)
+			return
+		}
+	}
+
+	buildKitOpts, err := buildKitClientOpts(plan.BuildKitHost.ValueString(), plan.BuildKitTLS)
+	if err != nil {
+		resp.Diagnostics.AddAttributeError(
+			path.Root("buildkit_tls"),
+			"Invalid BuildKit TLS configuration",
+			err.Error(),
+		)
+		return
+	}
+
+	isolation := container.Isolation(plan.Isolation.ValueString())
+
+	labels := map[string]string{}
+	diags = plan.Labels.ElementsAs(ctx, &labels, false)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	secrets := map[string][]byte{}
+	for index, secret := range plan.Secrets {
+		if secret.Source.ValueString() == "" {
+			secrets[secret.ID.ValueString()] = []byte(secret.Value.ValueString())
+			continue
+		}
+
+		content, err := os.ReadFile(secret.Source.ValueString())
+		if err != nil {
+			resp.Diagnostics.AddAttributeError(
+				path.Root("secrets").AtListIndex(index).AtName("source"),
+				"Unable to read build secret",
+				"Could not read build secret "+secret.ID.ValueString()+", unexpected error: "+err.Error(),
+			)
+			return
+		}
+		secrets[secret.ID.ValueString()] = content
+	}
+
+	cacheTo := slices.Clone(plan.CacheTo)
+	if plan.InlineCache.ValueBool() {
+		cacheTo = append(cacheTo, "type=inline")
+	}
+
+	cacheExports, err := parseCacheExporters(cacheTo)
+	if err != nil {
+		resp.Diagnostics.AddAttributeError(
+			path.Root("cache_to"),
+			"Invalid cache exporter",
+			err.Error(),
+		)
+		return
+	}
+
+	planBuildArgs := map[string]string{}
+	diags = plan.BuildArgs.ElementsAs(ctx, &planBuildArgs, false)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	buildArgs, err := mergeBuildArgs(plan.BuildArgFiles, planBuildArgs)
+	if err != nil {
+		resp.Diagnostics.AddAttributeError(
+			path.Root("build_arg_files"),
+			"Unable to read build arguments",
+			"Could not read build argument file, unexpected error: "+err.Error(),
+		)
+		return
+	}
+	maps.Copy(buildArgs, cacheExportBuildArgs(cacheExports))
+
+	if plan.ContextHash.IsUnknown() {
+		contextHash, err := buildContextHash(ctx, dir, plan.RemoteContext.ValueString(), plan.DockerFileName.ValueString(), plan.DockerFileContent.ValueString(), plan.Excludes, buildArgs)
+		if err != nil {
+			resp.Diagnostics.AddAttributeError(
+				path.Root("dir"),
+				"Unable to read build context",
+				"Could not read build context "+dir+", unexpected error: "+err.Error(),
+			)
+			return
+		}
+		plan.ContextHash = types.StringValue(contextHash)
+	}
+
+	triggers := map[string]string{}
+	diags = plan.Triggers.ElementsAs(ctx, &triggers, false)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	buildOptions := dockertypes.ImageBuildOptions{
+		RemoteContext: plan.RemoteContext.ValueString(),
+		Target:        plan.Target.ValueString(),
+		NoCache:       true,
+		Remove:        true,
+		ForceRemove:   plan.ForceRemove.ValueBool(),
+		NetworkMode:   plan.NetworkMode.ValueString(),
+		ExtraHosts:    plan.ExtraHosts,
+		Isolation:     isolation,
+		CacheFrom:     plan.CacheFrom,
+		BuildArgs:     buildArgs,
+		Labels:        labels,
+		BuildID:       identity.NewID(),
+	}
+	if !plan.NoCache.IsNull() {
+		buildOptions.NoCache = plan.NoCache.ValueBool()
+	}
+	if !plan.Remove.IsNull() {
+		buildOptions.Remove = plan.Remove.ValueBool()
+	}
+	if plan.Output != nil {
+		buildOptions.Outputs = []dockertypes.ImageBuildOutput{
+			{
+				Type:  plan.Output.Type.ValueString(),
+				Attrs: map[string]string{"dest": plan.Output.Dest.ValueString()},
+			},
+		}
+	}
+
+	// Identifies images built from the same context and configuration
+	buildHash := buildFingerprint(plan.ContextHash.ValueString(), platform, triggers, baseImageDigests, buildOptions)
+	labels[buildHashLabel] = buildHash
+
+	// An image built from the same context and configuration, e.g. by an
+	// apply that failed after the build, is reused rather than rebuilt. A
+	// remote context is only hashed by its URL, which may point at new
+	// commits, and nocache asks for a fresh build, so neither is reused.
+	imageID := ""
+	if plan.Output == nil {
+		if plan.RemoteContext.ValueString() == "" && !buildOptions.NoCache {
+			imageID = reusableImage(r, ctx, plan.Tags, buildHash)
+		}
+
+		// The build tags the image, so tags are checked against the image
+		// that is reused, if any, before it starts
+		checkTagOverwrite(r, ctx, plan.Overwrite, plan.Tags, imageID, &resp.Diagnostics)
+		if resp.Diagnostics.HasError() {
+			return
+		}
+	}
+
+	if imageID != "" {
+		tflog.Info(ctx, "Reusing image built from the same context", map[string]any{"id": imageID})
+		plan.BuildLog = types.StringValue("Reused image " + imageID + " built from the same context.\n")
+	} else {
+		// Builds Image
+		buildResponse, err := imageBuild(r, ctx, dir, dockerFile, dockerFileContent, plan.Excludes, plan.Tags, platform, plan.Builder.ValueString(), plan.BuildKitHost.ValueString(), buildKitOpts, buildOptions, cacheExports, secrets)
+
+		if err != nil {
+			tflog.Debug(ctx, "Unable to build docker image")
+			tflog.Debug(ctx, err.Error())
+
+			resp.Diagnostics.AddError(
+				"Unable to build docker image",
+				"Could not build docker image, unexpected error: "+err.Error(),
+			)
+			return
+		}
+		defer buildResponse.Body.Close()
+
+		// Check if build response can be parsed
+		buildOutput := &buildLog{}
+		result, parseErr := parseDockerDaemonJsonMessages(ctx, buildResponse.Body, buildOutput)
+		plan.BuildLog = types.StringValue(buildOutput.String())
+		if parseErr != nil && ctx.Err() != nil {
+			tflog.Info(ctx, "Image build cancelled", map[string]any{"build_id": buildOptions.BuildID})
+			cancelImageBuild(r, ctx, buildOptions.BuildID, buildResponse.Body, plan.PruneOnCancel.ValueBool())
+
+			resp.Diagnostics.AddError(
+				"Unable to build docker image",
+				"Could not build docker image, the build was cancelled: "+ctx.Err().Error(),
+			)
+			return
+		}
+		if parseErr != nil {
+			tflog.Debug(ctx, "Unable to read image build response", map[string]any{"error": parseErr.Error()})
+
+			resp.Diagnostics.AddError(
+				"Unable to build docker image",
+				"Could not build docker image, unexpected error: "+parseErr.Error()+"\n\nLast lines of the build output:\n"+buildOutput.tail(buildErrorLines),
+			)
+			return
+		}
+
+		if plan.Output != nil {
+			tflog.Debug(ctx, "Successfully wrote build output", map[string]any{"dest": plan.Output.Dest.ValueString()})
+
+			// No image is stored in the daemon
+			plan.ID = types.StringValue(result.ID)
+			if result.ID == "" {
+				plan.ID = plan.ContextHash
+			}
+			plan.Created = types.StringValue(time.Now().UTC().Format(time.RFC3339))
+			plan.RepoDigest = types.StringNull()
+			plan.SizeBytes = types.Int64Null()
+			plan.Architecture = types.StringNull()
+			plan.OS = types.StringNull()
+			plan.Variant = types.StringNull()
+			plan.ImageConfig = types.ObjectNull(imageConfigAttrTypes)
+
+			if baseImageDigests != nil {
+				plan.BaseImageDigests, diags = types.MapValueFrom(ctx, types.StringType, baseImageDigests)
+				resp.Diagnostics.Append(diags...)
+			}
+
+			diags = resp.State.Set(ctx, &plan)
+			resp.Diagnostics.Append(diags...)
+			return
+		}
+
+		tflog.Debug(ctx, "Successfully read image build response", map[string]any{"id": result.ID})
+		imageID = result.ID
+	}
+
+	// Map response body to schema and populate Computed attribute values
+	imageInspect, err := inspectImage(r, ctx, imageID)
+	if err != nil {
+		resp.Diagnostics.AddError(
+			"Unable to read docker image",
+			"Could not read built docker image "+imageID+", unexpected error: "+err.Error(),
+		)
+		return
+	}
+
+	if plan.OutputPath.ValueString() != "" {
+		err = saveImage(r, ctx, imageInspect.ID, plan.Tags, plan.OutputPath.ValueString())
+		if err != nil {
+			resp.Diagnostics.AddError(
+				"Unable to save docker image",
+				"Could not save docker image to "+plan.OutputPath.ValueString()+", unexpected error: "+err.Error(),
+			)
+		}
+	}
+
+	plan.ID = types.StringValue(imageInspect.ID)
+	plan.Created = types.StringValue(imageInspect.Created)
+	plan.RepoDigest = repoDigest(imageInspect, plan.Tags)
+	plan.SizeBytes = types.Int64Value(imageInspect.Size)
+	plan.Architecture = types.StringValue(imageInspect.Architecture)
+	plan.OS = types.StringValue(imageInspect.Os)
+	plan.Variant = types.StringValue(imageInspect.Variant)
+
+	config, diags := imageConfig(ctx, imageInspect)
+	resp.Diagnostics.Append(diags...)
+	plan.ImageConfig = config
+
+	if baseImageDigests != nil {
+		plan.BaseImageDigests, diags = types.MapValueFrom(ctx, types.StringType, baseImageDigests)
+		resp.Diagnostics.Append(diags...)
+	}
+
+	plan.Tags = imageTags(ctx, imageInspect.RepoTags, plan.Tags, "")
+
+	// Set state to fully populated data
+	diags = resp.State.Set(ctx, &plan)
+
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+}
+
+// Read refreshes the Terraform state with the latest data.
+func (r *imageResource) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
+	// Get current state
+	var state imageResourceModel
+	diags := req.State.Get(ctx, &state)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	// Outputs are only checked for existence, as they are not stored in the
+	// daemon
+	if state.Output != nil {
+		if _, err := os.Stat(state.Output.Dest.ValueString()); err != nil {
+			resp.State.RemoveResource(ctx)
+		}
+		return
+	}
+
+	// Returns the image information and its raw representation.
+	imageInspect, err := inspectImage(r, ctx, state.ID.ValueString())
+	if err != nil {
 		// resp.Diagnostics.AddError(
 		// 	"Error Reading Image",
 		// 	"Could not read Image ID "+state.ID.ValueString()+": "+err.Error(),
@@ -246,416 +1372,1253 @@ func (r *imageResource) Read(ctx context.Context, req resource.ReadRequest, resp
 
 	state.ID = types.StringValue(imageInspect.ID)
 	state.Created = types.StringValue(imageInspect.Created)
+	state.RepoDigest = repoDigest(imageInspect, state.Tags)
+	state.SizeBytes = types.Int64Value(imageInspect.Size)
+	state.Architecture = types.StringValue(imageInspect.Architecture)
+	state.OS = types.StringValue(imageInspect.Os)
+	state.Variant = types.StringValue(imageInspect.Variant)
+
+	config, diags := imageConfig(ctx, imageInspect)
+	resp.Diagnostics.Append(diags...)
+	state.ImageConfig = config
+
+	// The tag of a pulled image is part of pull rather than tags
+	pullTag := ""
+	if state.Pull != nil {
+		pullTag = pullReferenceTag(state.Pull.Reference.ValueString())
+	}
+
+	state.Tags = imageTags(ctx, imageInspect.RepoTags, state.Tags, pullTag)
+
+	// Set refreshed state
+	diags = resp.State.Set(ctx, &state)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+}
+
+// Update updates the resource and sets the updated Terraform state on success.
+func (r *imageResource) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
+	var plan imageResourceModel
+	diags := req.Plan.Get(ctx, &plan)
+	resp.Diagnostics.Append(diags...)
+
+	var state imageResourceModel
+	diags = req.State.Get(ctx, &state)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	// Timeouts and prune_on_cancel only apply to later operations
+	state.Timeouts = plan.Timeouts
+	state.PruneOnCancel = plan.PruneOnCancel
+	state.Overwrite = plan.Overwrite
+	state.RebuildOnBase = plan.RebuildOnBase
+
+	// Set when the image was built before context_hash was introduced
+	if !plan.ContextHash.IsUnknown() {
+		state.ContextHash = plan.ContextHash
+	}
+
+	addedTags := slices.DeleteFunc(slices.Clone(plan.Tags), func(tag tagModel) bool {
+		return containsTag(state.Tags, tag)
+	})
+	checkTagOverwrite(r, ctx, plan.Overwrite, addedTags, state.ID.ValueString(), &resp.Diagnostics)
+	if resp.Diagnostics.HasError() {
+		resp.Diagnostics.Append(resp.State.Set(ctx, &state)...)
+		return
+	}
+
+	// Tags are added before others are removed, so that the image always
+	// keeps a tag and is not deleted with its last one
+	for _, tag := range plan.Tags {
+		if containsTag(state.Tags, tag) {
+			continue
+		}
+
+		repoTag := tag.Repository.ValueString() + ":" + tag.Tag.ValueString()
+		err := retryOnTransientError(ctx, r.retry, "image tag", func() error {
+			return r.client.ImageTag(ctx, state.ID.ValueString(), repoTag)
+		})
+		if err != nil {
+			resp.Diagnostics.AddError(
+				"Unable to tag docker image",
+				"Could not tag docker image as "+repoTag+", unexpected error: "+err.Error(),
+			)
+			resp.Diagnostics.Append(resp.State.Set(ctx, &state)...)
+			return
+		}
+		state.Tags = append(state.Tags, tag)
+	}
+
+	for _, tag := range slices.Clone(state.Tags) {
+		if containsTag(plan.Tags, tag) {
+			continue
+		}
+
+		// Removing a reference to an image that has other tags only untags it
+		repoTag := tag.Repository.ValueString() + ":" + tag.Tag.ValueString()
+		err := retryOnTransientError(ctx, r.retry, "image untag", func() error {
+			_, err := r.client.ImageRemove(ctx, repoTag, image.RemoveOptions{})
+			return err
+		})
+		if err != nil && !errdefs.IsNotFound(err) {
+			resp.Diagnostics.AddError(
+				"Unable to untag docker image",
+				"Could not remove tag "+repoTag+" from docker image, unexpected error: "+err.Error(),
+			)
+			resp.Diagnostics.Append(resp.State.Set(ctx, &state)...)
+			return
+		}
+		state.Tags = slices.DeleteFunc(state.Tags, func(stateTag tagModel) bool {
+			return tagsEqual(stateTag, tag)
+		})
+	}
+
+	state.Tags = plan.Tags
+
+	diags = resp.State.Set(ctx, &state)
+	resp.Diagnostics.Append(diags...)
+}
+
+// tagsRequireReplace replaces the image when all of its tags are removed, as
+// removing the last tag of a built image removes the image itself, and when the
+// image is written to output, as the tags are then part of the output.
+func tagsRequireReplace(ctx context.Context, req planmodifier.ListRequest, resp *listplanmodifier.RequiresReplaceIfFuncResponse) {
+	var output, pull types.Object
+	resp.Diagnostics.Append(req.Plan.GetAttribute(ctx, path.Root("output"), &output)...)
+	resp.Diagnostics.Append(req.Plan.GetAttribute(ctx, path.Root("pull"), &pull)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	// A pulled image keeps the tag it was pulled by
+	lastTagRemoved := pull.IsNull() && len(req.StateValue.Elements()) > 0 && len(req.PlanValue.Elements()) == 0
+
+	resp.RequiresReplace = !output.IsNull() || lastTagRemoved
+}
+
+// checkTagOverwrite adds an error to diagnostics if overwrite is false and
+// any of tags already points at an image other than imageID, or at any image
+// if imageID is empty.
+func checkTagOverwrite(r *imageResource, ctx context.Context, overwrite types.Bool, tags []tagModel, imageID string, diagnostics *diag.Diagnostics) {
+	if overwrite.IsNull() || overwrite.ValueBool() {
+		return
+	}
+
+	clobbered := []string{}
+	for _, tag := range tags {
+		repoTag := tag.Repository.ValueString() + ":" + tag.Tag.ValueString()
+		imageInspect, err := inspectImage(r, ctx, repoTag)
+		if errdefs.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			diagnostics.AddError(
+				"Unable to read docker image",
+				"Could not read docker image "+repoTag+", unexpected error: "+err.Error(),
+			)
+			return
+		}
+		if imageInspect.ID != imageID {
+			clobbered = append(clobbered, repoTag+" ("+imageInspect.ID+")")
+		}
+	}
+
+	if len(clobbered) > 0 {
+		diagnostics.AddAttributeError(
+			path.Root("tags"),
+			"Docker image tag already exists",
+			"Could not tag docker image, as overwrite is false and these tags already point at other images: "+strings.Join(clobbered, ", ")+". Remove the tags or set overwrite to true to move them to this image.",
+		)
+	}
+}
+
+func containsTag(tags []tagModel, tag tagModel) bool {
+	return slices.ContainsFunc(tags, func(other tagModel) bool {
+		return tagsEqual(other, tag)
+	})
+}
+
+func tagsEqual(a tagModel, b tagModel) bool {
+	return a.Repository.Equal(b.Repository) && a.Tag.Equal(b.Tag)
+}
+
+// Delete deletes the resource and removes the Terraform state on success.
+func (r *imageResource) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
+	// Retrieve values from state
+	var state imageResourceModel
+	diags := req.State.Get(ctx, &state)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := withOperationTimeout(ctx, state.Timeouts.delete(), path.Root("timeouts").AtName("delete"), r.timeouts.delete, &resp.Diagnostics)
+	defer cancel()
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	// Outputs written to disk are left in place
+	if state.Output != nil {
+		return
+	}
+
+	// Delete Docker Image
+	err := retryOnTransientError(ctx, r.retry, "image remove", func() error {
+		_, err := r.client.ImageRemove(ctx, state.ID.ValueString(), image.RemoveOptions{Force: true, PruneChildren: true})
+		return err
+	})
+	if err != nil {
+		tflog.Debug(ctx, "Unable to remove docker image")
+		tflog.Debug(ctx, err.Error())
+
+		resp.Diagnostics.AddError(
+			"Unable to remove docker image",
+			"Could not remove docker image, unexpected error: "+err.Error(),
+		)
+	}
+}
+
+func (r *imageResource) ImportState(ctx context.Context, req resource.ImportStateRequest, resp *resource.ImportStateResponse) {
+	// Retrieve import ID and save to id attribute
+	resource.ImportStatePassthroughID(ctx, path.Root("id"), req, resp)
+
+	// If there are no errors, Terraform will automatically call the Read method to import the rest of the Terraform state.
+}
+
+// Configure adds the provider configured client to the data source.
+func (r *imageResource) Configure(_ context.Context, req resource.ConfigureRequest, resp *resource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+
+	providerData, ok := req.ProviderData.(*dockerProviderData)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Data Source Configure Type",
+			fmt.Sprintf("Expected *dockerProviderData, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+		)
+
+		return
+	}
+
+	providerData.requireDaemon("docker_image", &resp.Diagnostics)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	r.client = providerData.client
+	r.registryAuths = providerData.registryAuths
+	r.insecureRegistries = providerData.insecureRegistries
+	r.configDir = providerData.configDir
+	r.retry = providerData.retry
+	r.timeouts = providerData.timeouts
+}
+
+// func createTarFromDir(dir string, ctx context.Context) *bytes.Reader {
+
+// 	buf := new(bytes.Buffer)
+// 	tw := tar.NewWriter(buf)
+// 	defer tw.Close()
+
+// 	items, _ := os.ReadDir(dir)
+// 	for _, item := range items {
+// 		if item.IsDir() {
+// 			subitems, _ := os.ReadDir(item.Name())
+// 			for _, subitem := range subitems {
+// 				if !subitem.IsDir() {
+// 					// handle file there
+// 					fmt.Println("****dirfile")
+// 					fmt.Println(item.Name() + "/" + subitem.Name())
+// 				}
+// 			}
+// 		} else {
+// 			// handle file there
+// 			fmt.Println("****file")
+// 			fmt.Println(item.Name())
+
+// 			addFileToTar(ctx, tw, dir, item.Name())
+// 		}
+// 	}
+
+// 	buildContext := bytes.NewReader(buf.Bytes())
+
+// 	return buildContext
+// }
+
+// Move inside each directory and write info to tar
+// dirPath : folder which you want to tar it.
+// tw      : its tarFile writer to your tar file.
+func traverseDirectoryAddFileToTar(ctx context.Context, tw *tar.Writer, dirPath string) (int, error) {
+	return addDirectoryToTar(ctx, tw, dirPath, "", nil)
+}
+
+// addDirectoryToTar adds the directory at relDir, relative to the root of the
+// build context contextDir, and everything below it to the tar, except for
+// the paths matched by excludes, if set. It returns the number of files and
+// directories added, or an error if a file or directory cannot be read.
+func addDirectoryToTar(ctx context.Context, tw *tar.Writer, contextDir string, relDir string, excludes *patternmatcher.PatternMatcher) (int, error) {
+
+	fileCount := 0
+
+	// Open the directory
+	dir, err := os.Open(filepath.Join(contextDir, relDir))
+	if err != nil {
+		return fileCount, err
+	}
+
+	defer dir.Close()
+	// read all the files/dir in it
+	fis, err := dir.Readdir(0)
+
+	if err != nil {
+		return fileCount, fmt.Errorf("unable to read directory %s: %w", filepath.Join(contextDir, relDir), err)
+	}
+
+	// Keeps the tar, and so the context_hash, independent of directory order
+	sort.Slice(fis, func(i, j int) bool { return fis[i].Name() < fis[j].Name() })
+
+	for _, fi := range fis {
+		relPath := filepath.Join(relDir, fi.Name())
+
+		if excludes != nil {
+			excluded, err := excludes.MatchesOrParentMatches(filepath.ToSlash(relPath))
+			if err != nil {
+				return fileCount, fmt.Errorf("unable to match %s against excludes: %w", relPath, err)
+			}
+
+			// An excluded directory is still searched if some of its
+			// content may be included again by a !pattern
+			if excluded && (!fi.IsDir() || !excludes.Exclusions()) {
+				continue
+			}
+			if !excluded {
+				if err := addFileToTar(ctx, tw, contextDir, relPath); err != nil {
+					return fileCount, err
+				}
+			}
+			if fi.IsDir() {
+				dirFileCount, err := addDirectoryToTar(ctx, tw, contextDir, relPath, excludes)
+				fileCount += dirFileCount
+				if err != nil {
+					return fileCount, err
+				}
+			}
+		} else {
+			if err := addFileToTar(ctx, tw, contextDir, relPath); err != nil {
+				return fileCount, err
+			}
+			if fi.IsDir() {
+				dirFileCount, err := addDirectoryToTar(ctx, tw, contextDir, relPath, nil)
+				fileCount += dirFileCount
+				if err != nil {
+					return fileCount, err
+				}
+			}
+		}
+
+		tflog.Trace(ctx, "Added to build context", map[string]any{"path": filepath.Join(contextDir, relPath)})
+
+		fileCount += 1
+	}
+
+	return fileCount, nil
+}
+
+// addFileToTar adds the file, directory or symlink fileName, relative to the
+// root of the build context dir, to the tar, keeping its permissions and
+// ownership. Symlinks are added as links rather than followed. It returns an
+// error if the file cannot be read or added, which leaves the tar incomplete.
+func addFileToTar(ctx context.Context, tw *tar.Writer, dir string, fileName string) error {
+
+	filePath := filepath.Join(dir, fileName)
+
+	fileInfo, err := os.Lstat(filePath)
+	if err != nil {
+		return err
+	}
+
+	link := ""
+	if fileInfo.Mode()&os.ModeSymlink != 0 {
+		link, err = os.Readlink(filePath)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Fails for sockets and devices, which cannot be part of a build context
+	tarHeader, err := tar.FileInfoHeader(fileInfo, link)
+	if err != nil {
+		tflog.Debug(ctx, "Skipped "+filePath+" from build context: "+err.Error())
+		return nil
+	}
+
+	// Tar entries use forward slashes regardless of the OS, e.g. on Windows
+	tarHeader.Name = filepath.ToSlash(fileName)
+	if fileInfo.IsDir() {
+		tarHeader.Name += "/"
+	}
+
+	// Timestamps are left out so that the context_hash only changes with
+	// the content of the context
+	tarHeader.ModTime = time.Time{}
+	tarHeader.AccessTime = time.Time{}
+	tarHeader.ChangeTime = time.Time{}
+	tarHeader.Uname = ""
+	tarHeader.Gname = ""
+
+	err = tw.WriteHeader(tarHeader)
+	if err != nil {
+		return fmt.Errorf("unable to add %s to the build context: %w", filePath, err)
+	}
+
+	if !fileInfo.Mode().IsRegular() {
+		return nil
+	}
+
+	fileReader, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer fileReader.Close()
+
+	// A file that changes size while it is read would leave a truncated or
+	// overlong entry in the tar
+	written, err := io.Copy(tw, fileReader)
+	if err == nil && written != fileInfo.Size() {
+		err = fmt.Errorf("file changed while it was read")
+	}
+	if err != nil {
+		return fmt.Errorf("unable to add %s to the build context: %w", filePath, err)
+	}
+
+	return nil
+}
+
+// saveImage writes the image to a tar archive at outputPath. The image is
+// saved by its tags, if any, so that they are restored when it is loaded.
+func saveImage(r *imageResource, ctx context.Context, imageID string, tags []tagModel, outputPath string) error {
+	references := []string{}
+	for _, tag := range tags {
+		references = append(references, tag.Repository.ValueString()+":"+tag.Tag.ValueString())
+	}
+	if len(references) == 0 {
+		references = append(references, imageID)
+	}
+
+	archive, err := r.client.ImageSave(ctx, references)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	// Writes to a temporary file first so that an interrupted save does not
+	// leave a truncated archive at outputPath
+	file, err := os.CreateTemp(filepath.Dir(outputPath), filepath.Base(outputPath)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	_, err = io.Copy(file, archive)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), outputPath)
+}
+
+// Label holding the buildFingerprint of an image built by docker_image.
+const buildHashLabel = "terraform-provider-docker.build-hash"
+
+// buildFingerprint returns a hash of everything that determines the result of
+// a build: the context hash, the platform, the triggers, the base images and
+// the build options.
+func buildFingerprint(contextHash string, platform string, triggers map[string]string, baseImageDigests map[string]string, buildOptions dockertypes.ImageBuildOptions) string {
+	// Maps are encoded with sorted keys, so the encoding is stable
+	encoded, _ := json.Marshal(map[string]any{
+		"context_hash":       contextHash,
+		"platform":           platform,
+		"triggers":           triggers,
+		"base_image_digests": baseImageDigests,
+		"target":             buildOptions.Target,
+		"nocache":            buildOptions.NoCache,
+		"network_mode":       buildOptions.NetworkMode,
+		"extra_hosts":        buildOptions.ExtraHosts,
+		"isolation":          buildOptions.Isolation,
+		"build_args":         buildOptions.BuildArgs,
+		"labels":             buildOptions.Labels,
+	})
+
+	hash := sha256.Sum256(encoded)
+	return "sha256:" + hex.EncodeToString(hash[:])
+}
+
+// reusableImage returns the ID of the image that all tags point at, if it was
+// built with buildHash, or an empty string otherwise.
+func reusableImage(r *imageResource, ctx context.Context, tags []tagModel, buildHash string) string {
+	imageID := ""
+	for _, tag := range tags {
+		imageInspect, err := inspectImage(r, ctx, tag.Repository.ValueString()+":"+tag.Tag.ValueString())
+		if err != nil {
+			return ""
+		}
+		if imageID != "" && imageInspect.ID != imageID {
+			return ""
+		}
+		if imageInspect.Config == nil || imageInspect.Config.Labels[buildHashLabel] != buildHash {
+			return ""
+		}
+		imageID = imageInspect.ID
+	}
+
+	return imageID
+}
+
+// repoDigest returns the repository digest of the image, preferring the one
+// of the repository of the first tag, as an image pushed to several
+// repositories has a digest for each of them.
+func repoDigest(imageInspect dockertypes.ImageInspect, tags []tagModel) types.String {
+	if len(imageInspect.RepoDigests) == 0 {
+		return types.StringNull()
+	}
+
+	if len(tags) > 0 {
+		for _, repoDigest := range imageInspect.RepoDigests {
+			repository, _, err := splitRepoDigest(repoDigest)
+			if err == nil && sameRepository(repository, tags[0].Repository.ValueString()) {
+				return types.StringValue(repoDigest)
+			}
+		}
+	}
+
+	return types.StringValue(imageInspect.RepoDigests[0])
+}
+
+// imageTags returns the repo tags of an image, as reported by the daemon, as
+// tags. Repositories keep their spelling in current, e.g.
+// "docker.io/library/app" rather than "app", so that they do not show as
+// changed. exclude is a repo tag to leave out, if set.
+func imageTags(ctx context.Context, repoTags []string, current []tagModel, exclude string) []tagModel {
+	tags := []tagModel{}
+	for _, item := range repoTags {
+		if item == exclude {
+			continue
+		}
+
+		repository, tag, err := splitRepoTag(item)
+		if err != nil {
+			tflog.Debug(ctx, "Unable to parse repo tag "+item+": "+err.Error())
+			continue
+		}
+
+		for _, currentTag := range current {
+			if currentTag.Tag.ValueString() == tag && sameRepository(currentTag.Repository.ValueString(), repository) {
+				repository = currentTag.Repository.ValueString()
+			}
+		}
+
+		tags = append(tags, tagModel{
+			Repository: types.StringValue(repository),
+			Tag:        types.StringValue(tag),
+		})
+	}
+
+	// Tags that are not set stay unset rather than becoming an empty list
+	if len(tags) == 0 && current == nil {
+		return nil
+	}
+
+	return tags
+}
+
+// inspectImage returns the image information, retrying on transient errors.
+func inspectImage(r *imageResource, ctx context.Context, imageID string) (dockertypes.ImageInspect, error) {
+	var imageInspect dockertypes.ImageInspect
+	err := retryOnTransientError(ctx, r.retry, "image inspect", func() error {
+		var err error
+		imageInspect, _, err = r.client.ImageInspectWithRaw(ctx, imageID)
+		return err
+	})
+
+	return imageInspect, err
+}
+
+// parseDockerDaemonJsonMessages reads the JSON messages streamed by the daemon
+// during a build or pull, writing the build output to output.
+func parseDockerDaemonJsonMessages(ctx context.Context, r io.Reader, output io.Writer) (dockertypes.BuildResult, error) {
+	var result dockertypes.BuildResult
+	progress := newBuildProgress()
+	defer progress.finishClassicStep(ctx)
+	decoder := json.NewDecoder(r)
+	for {
+		var jsonMessage jsonmessage.JSONMessage
+		if err := decoder.Decode(&jsonMessage); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return result, err
+		}
+		if jsonMessage.Stream != "" {
+			fmt.Fprint(output, jsonMessage.Stream)
+			tflog.Debug(ctx, "Build output", map[string]any{"output": strings.TrimRight(jsonMessage.Stream, "\n")})
+			progress.classicOutput(ctx, jsonMessage.Stream)
+		}
+		if err := jsonMessage.Error; err != nil {
+			fmt.Fprintf(output, "ERROR: %s\n", err.Message)
+			return result, err
+		}
+		if jsonMessage.ID == buildKitTraceID && jsonMessage.Aux != nil {
+			if err := progress.buildKitTrace(ctx, *jsonMessage.Aux, output); err != nil {
+				tflog.Debug(ctx, "Unable to decode BuildKit progress", map[string]any{"error": err.Error()})
+			}
+			continue
+		}
+		if jsonMessage.Aux != nil {
+			var r dockertypes.BuildResult
+			if err := json.Unmarshal(*jsonMessage.Aux, &r); err != nil {
+				// logrus.Warnf("Failed to unmarshal aux message. Cause: %s", err)
+			} else {
+				result.ID = r.ID
+			}
+		}
+	}
+	return result, nil
+}
+
+// buildCancelTimeout bounds the cleanup of a cancelled build, which runs after
+// Terraform has already given up on the apply.
+const buildCancelTimeout = 30 * time.Second
+
+// cancelImageBuild stops the build with buildID after ctx is cancelled. The
+// daemon is asked to cancel it, which it only does on its own for classic
+// builds when the connection is closed, and the rest of body is drained so
+// that the build output is not left blocked on a reader that is gone. If
+// prune is set, the dangling images left behind by the build are removed.
+func cancelImageBuild(r *imageResource, ctx context.Context, buildID string, body io.ReadCloser, prune bool) {
+	cleanupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), buildCancelTimeout)
+	defer cancel()
+
+	if err := r.client.BuildCancel(cleanupCtx, buildID); err != nil {
+		tflog.Debug(ctx, "Unable to cancel image build", map[string]any{"build_id": buildID, "error": err.Error()})
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		io.Copy(io.Discard, body)
+	}()
+	select {
+	case <-drained:
+	case <-cleanupCtx.Done():
+		tflog.Debug(ctx, "Timed out draining cancelled image build", map[string]any{"build_id": buildID})
+	}
+	body.Close()
+
+	if !prune {
+		return
+	}
+
+	report, err := r.client.ImagesPrune(cleanupCtx, filters.NewArgs(filters.Arg("dangling", "true")))
+	if err != nil {
+		tflog.Debug(ctx, "Unable to prune dangling images", map[string]any{"error": err.Error()})
+		return
+	}
+	tflog.Info(ctx, "Pruned dangling images of cancelled build", map[string]any{"images": len(report.ImagesDeleted), "reclaimed_bytes": report.SpaceReclaimed})
+}
+
+// buildContextTar returns the build context at dir as a tar, leaving out the
+// paths matched by excludes. If dockerFileContent is set, it is added as
+// dockerFile, replacing a file of the same name in dir when the daemon
+// extracts the tar. It returns an error if a file or directory of the context
+// cannot be read, or if excludes has an invalid pattern.
+func buildContextTar(ctx context.Context, dir string, dockerFile string, dockerFileContent string, excludes []string) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+
+	var matcher *patternmatcher.PatternMatcher
+	if len(excludes) > 0 {
+		var err error
+		matcher, err = patternmatcher.New(excludes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid excludes: %w", err)
+		}
+	}
+	if _, err := addDirectoryToTar(ctx, tw, dir, "", matcher); err != nil {
+		return nil, err
+	}
+
+	if dockerFileContent != "" {
+		err := tw.WriteHeader(&tar.Header{
+			Name: filepath.ToSlash(dockerFile),
+			Mode: 0o644,
+			Size: int64(len(dockerFileContent)),
+		})
+		if err == nil {
+			_, err = tw.Write([]byte(dockerFileContent))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to add dockerfile_content to the build context: %w", err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
 
-	// Gets each tag, puts it into tagModel{} and appends to state.Tags
-	state.Tags = []tagModel{}
-	for _, item := range imageInspect.RepoTags {
-		repotagSplit := strings.Split(item, ":")
+// contextExcludes returns the patterns of the paths to leave out of the build
+// context at dir: those of its .dockerignore, or of a <dockerFile>.dockerignore
+// next to the Dockerfile, followed by excludes. The Dockerfile and the
+// .dockerignore are always sent, as docker build does.
+func contextExcludes(dir string, dockerFile string, excludes []string) ([]string, error) {
+	patterns := []string{}
 
-		state.Tags = append(state.Tags, tagModel{
-			Repository: types.StringValue(repotagSplit[0]),
-			Tag:        types.StringValue(repotagSplit[1]),
-		})
+	ignoreFile, err := os.Open(filepath.Join(dir, dockerFile+".dockerignore"))
+	if os.IsNotExist(err) {
+		ignoreFile, err = os.Open(filepath.Join(dir, ".dockerignore"))
+	}
+	if err == nil {
+		defer ignoreFile.Close()
+		patterns, err = ignorefile.ReadAll(ignoreFile)
+		if err != nil {
+			return nil, err
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
 	}
 
-	// Set refreshed state
-	diags = resp.State.Set(ctx, &state)
-	resp.Diagnostics.Append(diags...)
-	if resp.Diagnostics.HasError() {
-		return
+	patterns = append(patterns, excludes...)
+	if len(patterns) == 0 {
+		return nil, nil
 	}
+
+	return append(patterns, "!"+filepath.ToSlash(dockerFile), "!.dockerignore"), nil
 }
 
-// Update updates the resource and sets the updated Terraform state on success.
-func (r *imageResource) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
+// outsideContextDockerfile returns the name under which the Dockerfile at
+// dockerFile, relative to dir, is added to the build context and its content,
+// if it is outside of dir, like docker build -f ../Dockerfile does. Otherwise
+// dockerFile is returned with empty content, as it is part of the context.
+func outsideContextDockerfile(dir string, dockerFile string) (string, string, error) {
+	dockerFilePath := dockerFile
+	if !filepath.IsAbs(dockerFilePath) {
+		dockerFilePath = filepath.Join(dir, dockerFile)
+	}
 
-	// // Get current image
-	// // Identifies tags that do not currently exist in the plan but have been provisioned
-	// // Check for differences between provisioned image and image specified in plan
-	// // If there is a difference in tags
-	// // Removes tags if there are more tags
-	// // Add tags if there are less tags
-
-	// // Retrieve values from plan
-	// var plan imageResourceModel
-	// diags := req.Plan.Get(ctx, &plan)
-	// resp.Diagnostics.Append(diags...)
-	// if resp.Diagnostics.HasError() {
-	// 	return
-	// }
-
-	// imageInspect, _, err := r.client.ImageInspectWithRaw(ctx, plan.ID.ValueString())
-	// if err != nil {
-	// 	// resp.Diagnostics.AddError(
-	// 	// 	"Error Reading Image",
-	// 	// 	"Could not read Image ID "+state.ID.ValueString()+": "+err.Error(),
-	// 	// )
-	// 	return
-	// }
-
-	// provisionedTags := []tagModel{}
-	// for _, item := range imageInspect.RepoTags {
-	// 	repotagSplit := strings.Split(item, ":")
-
-	// 	provisionedTags = append(provisionedTags, tagModel{
-	// 		Repository: types.StringValue(repotagSplit[0]),
-	// 		Tag:        types.StringValue(repotagSplit[1]),
-	// 	})
-	// }
-
-	// // Identifies tags that do not currently exist in the plan but have been provisioned
-	// uniqueTags := []tagModel{}
-	// for _, currentTag := range provisionedTags {
-	// 	exists := false
-	// 	for _, planTag := range plan.Tags {
-	// 		if currentTag == planTag {
-	// 			exists = true
-	// 		}
-	// 	}
-
-	// 	if !exists {
-	// 		uniqueTags = append(uniqueTags, currentTag)
-	// 	}
-	// }
-
-	// // // Prints unique Tags
-	// // for _, uniqueTag := range uniqueTags {
-	// // 	fmt.Println("uniqueTag")
-	// // 	fmt.Println(uniqueTag)
-	// // }
-
-	// if len(provisionedTags) > len(plan.Tags) {
-	// 	fmt.Println("Time to remove tags!")
-
-	// 	// Uses exec as the API does not support tag removal and requires removal of the entire image
-	// 	for _, uniqueTag := range uniqueTags {
-
-	// 		repotag := uniqueTag.Repository.ValueString() + ":" + uniqueTag.Tag.ValueString()
-
-	// 		fmt.Println("Removing tag: " + repotag)
-
-	// 		cmd := exec.Command("docker", "rmi", repotag)
-	// 		stdout, err := cmd.Output()
-
-	// 		if err != nil {
-	// 			fmt.Println(err.Error())
-	// 			return
-	// 		}
-
-	// 		// Print the output
-	// 		fmt.Println(string(stdout))
-	// 	}
-	// }
-
-	// if len(provisionedTags) < len(plan.Tags) {
-	// 	fmt.Println("Time to add tags!")
-
-	// 	buildResponse, err := imageBuild(r, ctx, plan.Dir.ValueString(), plan.DockerFileName.ValueString(), plan.Tags)
-
-	// 	if err != nil {
-	// 		tflog.Debug(ctx, "Unable to build docker image")
-	// 		tflog.Debug(ctx, err.Error())
-	// 	}
-	// 	defer buildResponse.Body.Close()
-	// }
-
-	// // If there are same number of tags, but the tags are different
-	// // Remove and rebuild image with correct tags
-	// if len(provisionedTags) == len(plan.Tags) && len(uniqueTags) > 0 {
-	// 	fmt.Println("Rebuild image with correct tags!")
-
-	// 	_, err = r.client.ImageRemove(ctx, plan.ID.ValueString(), image.RemoveOptions{Force: true, PruneChildren: true})
-	// 	if err != nil {
-	// 		tflog.Debug(ctx, "Unable to remove docker image")
-	// 		tflog.Debug(ctx, err.Error())
-	// 	}
-
-	// 	buildResponse, err := imageBuild(r, ctx, plan.Dir.ValueString(), plan.DockerFileName.ValueString(), uniqueTags)
-
-	// 	if err != nil {
-	// 		tflog.Debug(ctx, "Unable to build docker image")
-	// 		tflog.Debug(ctx, err.Error())
-	// 	}
-	// 	defer buildResponse.Body.Close()
-
-	// 	// Uses exec as the API does not support tag removal and requires removal of the entire image
-	// 	for _, tag := range plan.Tags {
-
-	// 		repotag := tag.Repository.ValueString() + ":" + tag.Tag.ValueString()
-
-	// 		fmt.Println("Removing tag: " + repotag)
-
-	// 		cmd := exec.Command("docker", "rmi", repotag)
-	// 		stdout, err := cmd.Output()
-
-	// 		if err != nil {
-	// 			fmt.Println(err.Error())
-	// 			return
-	// 		}
-
-	// 		// Print the output
-	// 		fmt.Println(string(stdout))
-	// 	}
-	// }
-
-	// // Map response body to schema and populate Computed attribute values
-	// imageInspect, _, err = r.client.ImageInspectWithRaw(ctx, plan.ID.ValueString())
-	// if err != nil {
-	// 	// resp.Diagnostics.AddError(
-	// 	// 	"Error Reading Image",
-	// 	// 	"Could not read Image ID "+state.ID.ValueString()+": "+err.Error(),
-	// 	// )
-	// 	return
-	// }
-
-	// fmt.Println("imageInspect.RepoTags")
-	// fmt.Println(imageInspect.RepoTags)
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", "", err
+	}
+	absDockerFilePath, err := filepath.Abs(dockerFilePath)
+	if err != nil {
+		return "", "", err
+	}
 
-	// plan.Tags = []tagModel{}
-	// for _, item := range imageInspect.RepoTags {
-	// 	repotagSplit := strings.Split(item, ":")
+	relPath, err := filepath.Rel(absDir, absDockerFilePath)
+	if err == nil && relPath != ".." && !strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+		return relPath, "", nil
+	}
 
-	// 	plan.Tags = append(plan.Tags, tagModel{
-	// 		Repository: types.StringValue(repotagSplit[0]),
-	// 		Tag:        types.StringValue(repotagSplit[1]),
-	// 	})
-	// }
+	content, err := os.ReadFile(absDockerFilePath)
+	if err != nil {
+		return "", "", err
+	}
 
-	// diags = resp.State.Set(ctx, plan)
-	// resp.Diagnostics.Append(diags...)
-	// if resp.Diagnostics.HasError() {
-	// 	return
-	// }
+	// Named after its path, so that the name stays the same across builds
+	hash := sha256.Sum256([]byte(absDockerFilePath))
+	return ".dockerfile." + hex.EncodeToString(hash[:6]), string(content), nil
 }
 
-// Delete deletes the resource and removes the Terraform state on success.
-func (r *imageResource) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
-	// Retrieve values from state
-	var state imageResourceModel
-	diags := req.State.Get(ctx, &state)
-	resp.Diagnostics.Append(diags...)
-	if resp.Diagnostics.HasError() {
-		return
+// buildContextHash returns the SHA256 of the build context at dir without
+// excludes, or of the URL of remoteContext if set, together with the
+// Dockerfile name and the build arguments. It returns an error if the build
+// context cannot be read.
+func buildContextHash(ctx context.Context, dir string, remoteContext string, dockerFileName string, dockerFileContent string, excludes []string, buildArgs map[string]*string) (string, error) {
+	hash := sha256.New()
+	if remoteContext != "" {
+		fmt.Fprintf(hash, "context=%s\n", remoteContext)
+	} else {
+		dockerFile := "Dockerfile"
+		if dockerFileName != "" {
+			dockerFile = dockerFileName
+		}
+		if dockerFileContent == "" {
+			// Errors are reported when the image is built
+			if name, content, err := outsideContextDockerfile(dir, dockerFile); err == nil {
+				dockerFile, dockerFileContent = name, content
+			}
+		}
+		patterns, err := contextExcludes(dir, dockerFile, excludes)
+		if err != nil {
+			tflog.Debug(ctx, "Unable to read .dockerignore: "+err.Error())
+			patterns = excludes
+		}
+		contextTar, err := buildContextTar(ctx, dir, dockerFile, dockerFileContent, patterns)
+		if err != nil {
+			return "", err
+		}
+		hash.Write(contextTar)
 	}
+	fmt.Fprintf(hash, "dockerfile=%s\n", dockerFileName)
 
-	// Delete Docker Image
-	_, err := r.client.ImageRemove(ctx, state.ID.ValueString(), image.RemoveOptions{Force: true, PruneChildren: true})
-	if err != nil {
-		tflog.Debug(ctx, "Unable to remove docker image")
-		tflog.Debug(ctx, err.Error())
-
-		resp.Diagnostics.AddError(
-			"Unable to remove docker image",
-			"Could not remove docker image, unexpected error: "+err.Error(),
-		)
+	keys := make([]string, 0, len(buildArgs))
+	for key := range buildArgs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := ""
+		if buildArgs[key] != nil {
+			value = *buildArgs[key]
+		}
+		fmt.Fprintf(hash, "arg=%s=%s\n", key, value)
 	}
+
+	return "sha256:" + hex.EncodeToString(hash.Sum(nil)), nil
 }
 
-func (r *imageResource) ImportState(ctx context.Context, req resource.ImportStateRequest, resp *resource.ImportStateResponse) {
-	// Retrieve import ID and save to id attribute
-	resource.ImportStatePassthroughID(ctx, path.Root("id"), req, resp)
+// imageBuild builds the image with the options set in buildOptions, after
+// filling in the build context, Dockerfile, tags and platform. secrets are
+// made available to RUN --mount=type=secret, which requires BuildKit. The
+// BuildKit of the daemon only exports the inline cache of cacheExports, which
+// it is asked for through a build argument.
+func imageBuild(r *imageResource, ctx context.Context, planDir string, dockerFileName string, dockerFileContent string, planExcludes []string, planTags []tagModel, planPlatform string, builder string, buildKitHost string, buildKitOpts []buildkitclient.ClientOpt, buildOptions dockertypes.ImageBuildOptions, cacheExports []buildkitclient.CacheOptionsEntry, secrets map[string][]byte) (dockertypes.ImageBuildResponse, error) {
 
-	// If there are no errors, Terraform will automatically call the Read method to import the rest of the Terraform state.
-}
+	// Defaults if not declared in terraform plan
+	dir := "."
+	if planDir != "" {
+		dir = planDir
+	}
 
-// Configure adds the provider configured client to the data source.
-func (r *imageResource) Configure(_ context.Context, req resource.ConfigureRequest, resp *resource.ConfigureResponse) {
-	if req.ProviderData == nil {
-		return
+	dockerFile := "Dockerfile"
+	if dockerFileName != "" {
+		dockerFile = dockerFileName
 	}
 
-	client, ok := req.ProviderData.(*client.Client)
-	if !ok {
-		resp.Diagnostics.AddError(
-			"Unexpected Data Source Configure Type",
-			fmt.Sprintf("Expected *hashicups.Client, got: %T. Please report this issue to the provider developers.", req.ProviderData),
-		)
+	platform := ""
+	if planPlatform != "" {
+		platform = planPlatform
+	}
 
-		return
+	// Assign tags
+	tags := []string{}
+	for _, item := range planTags {
+		imageTagName := item.Repository.ValueString() + string(":") + item.Tag.ValueString()
+		tags = append(tags, imageTagName)
 	}
 
-	r.client = client
-}
+	excludes, err := contextExcludes(dir, dockerFile, planExcludes)
+	if err != nil {
+		return dockertypes.ImageBuildResponse{}, err
+	}
 
-// func createTarFromDir(dir string, ctx context.Context) *bytes.Reader {
+	buildOptions.Dockerfile = filepath.ToSlash(dockerFile)
+	buildOptions.Tags = tags
+	buildOptions.Platform = platform
+	buildOptions.PullParent = true
+	buildOptions.AuthConfigs = buildAuthConfigs(r.registryAuths)
 
-// 	buf := new(bytes.Buffer)
-// 	tw := tar.NewWriter(buf)
-// 	defer tw.Close()
+	if buildKitHost != "" {
+		tflog.Debug(ctx, "Starting Image Build", map[string]any{"buildkit_host": buildKitHost})
 
-// 	items, _ := os.ReadDir(dir)
-// 	for _, item := range items {
-// 		if item.IsDir() {
-// 			subitems, _ := os.ReadDir(item.Name())
-// 			for _, subitem := range subitems {
-// 				if !subitem.IsDir() {
-// 					// handle file there
-// 					fmt.Println("****dirfile")
-// 					fmt.Println(item.Name() + "/" + subitem.Name())
-// 				}
-// 			}
-// 		} else {
-// 			// handle file there
-// 			fmt.Println("****file")
-// 			fmt.Println(item.Name())
+		return buildKitBuild(r, ctx, buildKitHost, dir, dockerFile, dockerFileContent, excludes, buildOptions, cacheExports, secrets, buildKitOpts...)
+	}
 
-// 			addFileToTar(ctx, tw, dir, item.Name())
-// 		}
-// 	}
+	// Other builders are buildx builder instances
+	if builder != "" && builder != builderBuildKit && builder != builderClassic {
+		buildxInstance, err := loadBuildxBuilder(r.configDir, builder)
+		if err != nil {
+			return dockertypes.ImageBuildResponse{}, err
+		}
 
-// 	buildContext := bytes.NewReader(buf.Bytes())
+		address, err := buildKitAddress(ctx, buildxInstance)
+		if err != nil {
+			return dockertypes.ImageBuildResponse{}, err
+		}
 
-// 	return buildContext
-// }
+		tflog.Debug(ctx, "Starting Image Build", map[string]any{"builder": builder, "address": address})
 
-// Move inside each directory and write info to tar
-// dirPath : folder which you want to tar it.
-// tw      : its tarFile writer to your tar file.
-func traverseDirectoryAddFileToTar(ctx context.Context, tw *tar.Writer, dirPath string) int {
+		if address != "" {
+			return buildKitBuild(r, ctx, address, dir, dockerFile, dockerFileContent, excludes, buildOptions, cacheExports, secrets)
+		}
 
-	fileCount := 0
+		// The docker driver builds with the BuildKit of the daemon
+		builder = builderBuildKit
+	}
 
-	// Open the directory
-	dir, err := os.Open(dirPath)
+	buildKit, err := useBuildKit(ctx, r.client, builder)
 	if err != nil {
-		log.Fatal(err)
+		return dockertypes.ImageBuildResponse{}, err
 	}
 
-	defer dir.Close()
-	// read all the files/dir in it
-	fis, err := dir.Readdir(0)
+	if len(buildOptions.Outputs) > 0 && !buildKit {
+		return dockertypes.ImageBuildResponse{}, fmt.Errorf("output requires BuildKit, which the daemon does not use by default; set builder = \"%s\"", builderBuildKit)
+	}
 
-	if err != nil {
-		log.Fatal(err)
+	if len(secrets) > 0 && !buildKit {
+		return dockertypes.ImageBuildResponse{}, fmt.Errorf("secrets require BuildKit, which the daemon does not use by default; set builder = \"%s\"", builderBuildKit)
 	}
 
-	for _, fi := range fis {
-		curPath := dirPath + "/" + fi.Name()
+	if _, ok := buildOptions.BuildArgs[inlineCacheBuildArg]; ok && !buildKit {
+		return dockertypes.ImageBuildResponse{}, fmt.Errorf("inline_cache and cache_to require BuildKit, which the daemon does not use by default; set builder = \"%s\"", builderBuildKit)
+	}
+
+	for _, exporter := range cacheExports {
+		if exporter.Type != "inline" {
+			return dockertypes.ImageBuildResponse{}, fmt.Errorf("the BuildKit of the daemon only exports type=inline caches, not type=%s; use a buildx builder with the docker-container, kubernetes or remote driver, or buildkit_host", exporter.Type)
+		}
+	}
 
-		addFileToTar(ctx, tw, dirPath, fi.Name())
-		if fi.IsDir() {
-			fileCount += traverseDirectoryAddFileToTar(ctx, tw, curPath)
+	// BuildKit reads a local context through the session, so that only the
+	// files changed since the last build are sent. The classic builder is sent
+	// the whole context as a tar, while the daemon fetches a remote context
+	// itself.
+	var buildContext *bytes.Reader
+	var contextSource session.Attachable
+	var dockerFileDir, sharedKey string
+	if buildOptions.RemoteContext == "" {
+		if buildKit {
+			contextSource, dockerFileDir, err = localContextSource(dir, dockerFileContent, excludes)
+			if err != nil {
+				return dockertypes.ImageBuildResponse{}, err
+			}
+			if dockerFileDir != "" {
+				buildOptions.Dockerfile = "Dockerfile"
+			}
+			buildOptions.RemoteContext = "client-session"
+			sharedKey = contextSharedKey(dir)
+		} else {
+			contextTar, err := buildContextTar(ctx, dir, dockerFile, dockerFileContent, excludes)
+			if err != nil {
+				return dockertypes.ImageBuildResponse{}, err
+			}
+			buildContext = bytes.NewReader(contextTar)
+			buildOptions.Context = buildContext
 		}
+	}
 
-		fmt.Println(curPath)
+	var buildSession *session.Session
+	if buildKit {
+		attachables := []session.Attachable{secretsprovider.FromMap(secrets)}
+		if contextSource != nil {
+			attachables = append(attachables, contextSource)
+		}
 
-		fileCount += 1
+		// The daemon sends outputs through the session, where the
+		// destination is only known to the client
+		outputs := []dockertypes.ImageBuildOutput{}
+		for _, output := range buildOptions.Outputs {
+			attachables = append(attachables, buildOutputTarget(output))
+			outputs = append(outputs, dockertypes.ImageBuildOutput{Type: output.Type})
+		}
+		buildOptions.Outputs = outputs
+
+		buildSession, err = newBuildSession(ctx, r.client, r.registryAuths, r.configDir, sharedKey, attachables...)
+		if err != nil {
+			if dockerFileDir != "" {
+				os.RemoveAll(dockerFileDir)
+			}
+			return dockertypes.ImageBuildResponse{}, fmt.Errorf("unable to start BuildKit session: %w", err)
+		}
+
+		buildOptions.Version = dockertypes.BuilderBuildKit
+		buildOptions.SessionID = buildSession.ID()
 	}
 
-	return fileCount
-}
+	tflog.Debug(ctx, "Starting Image Build", map[string]any{"buildkit": buildKit})
+
+	var buildResponse dockertypes.ImageBuildResponse
+	err = retryOnTransientError(ctx, r.retry, "image build", func() error {
+		var body io.Reader
+		if buildContext != nil {
+			// Rewinds the build context consumed by a previous attempt
+			_, err := buildContext.Seek(0, io.SeekStart)
+			if err != nil {
+				return err
+			}
+			body = buildContext
+		}
 
-func addFileToTar(ctx context.Context, tw *tar.Writer, dir string, fileName string) {
+		var err error
+		buildResponse, err = r.client.ImageBuild(ctx, body, buildOptions)
 
-	fileDir := dir
+		return err
+	})
 
-	// Checks and ensures that the dir can be joined with the filename to create a proper path
-	lastCharOfString := string(dir[len(dir)-1])
-	if lastCharOfString != "/" {
-		fileDir = dir + string("/")
+	if buildSession != nil {
+		if err != nil {
+			buildSession.Close()
+			if dockerFileDir != "" {
+				os.RemoveAll(dockerFileDir)
+			}
+		} else {
+			buildResponse.Body = sessionBody{ReadCloser: buildResponse.Body, session: buildSession, tempDir: dockerFileDir}
+		}
 	}
 
-	filePath := fileDir + fileName
+	return buildResponse, err
+}
 
-	fileReader, err := os.Open(filePath)
+// parseDockerfileBaseImages returns the image references used by FROM lines
+// in dockerFile. Stages built from an earlier stage and scratch are skipped.
+func parseDockerfileBaseImages(dockerFile string) []string {
+	baseImages := []string{}
+	stageNames := map[string]bool{"scratch": true}
 
-	if err != nil {
-		tflog.Debug(ctx, " :****unable to open Dockerfile")
+	for _, line := range strings.Split(dockerFile, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || !strings.EqualFold(fields[0], "FROM") {
+			continue
+		}
+
+		// Drops flags such as --platform=linux/amd64
+		args := []string{}
+		for _, field := range fields[1:] {
+			if !strings.HasPrefix(field, "--") {
+				args = append(args, field)
+			}
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		reference := args[0]
+		if !stageNames[strings.ToLower(reference)] {
+			baseImages = append(baseImages, reference)
+		}
+
+		if len(args) == 3 && strings.EqualFold(args[1], "AS") {
+			stageNames[strings.ToLower(args[2])] = true
+		}
 	}
-	readFile, err := io.ReadAll(fileReader)
+
+	return baseImages
+}
+
+// daemonPlatform returns the platform of the Docker daemon, in the form
+// os/arch.
+func daemonPlatform(r *imageResource, ctx context.Context) (string, error) {
+	serverVersion, err := r.client.ServerVersion(ctx)
 	if err != nil {
-		tflog.Debug(ctx, " :****unable to read dockerfile")
+		return "", err
 	}
 
-	tarHeader := &tar.Header{
-		Name: fileName,
-		Size: int64(len(readFile)),
+	return serverVersion.Os + "/" + serverVersion.Arch, nil
+}
+
+// createPulledImage pulls the image of the pull block of plan, tags it with
+// the tags of plan and populates the computed attributes of plan.
+func createPulledImage(r *imageResource, ctx context.Context, plan *imageResourceModel, diagnostics *diag.Diagnostics) {
+	pullReference := plan.Pull.Reference.ValueString()
+	if pullReference == "" {
+		diagnostics.AddAttributeError(
+			path.Root("pull").AtName("reference"),
+			"Invalid pull",
+			"reference must be set.",
+		)
+		return
 	}
-	err = tw.WriteHeader(tarHeader)
+
+	warning, err := insecureRegistryWarning(ctx, r.client, r.insecureRegistries, pullReference)
 	if err != nil {
-		tflog.Debug(ctx, " :****unable to write tar header")
+		tflog.Debug(ctx, "Unable to check insecure registry configuration of the daemon: "+err.Error())
+	}
+	if warning != "" {
+		diagnostics.AddWarning("Insecure registry not configured on the Docker daemon", warning)
 	}
-	_, err = tw.Write(readFile)
+
+	imageInspect, err := pullImage(r, ctx, pullReference, plan.Platform.ValueString())
 	if err != nil {
-		tflog.Debug(ctx, " :****unable to write tar body")
+		tflog.Debug(ctx, "Unable to pull docker image")
+		tflog.Debug(ctx, err.Error())
+
+		diagnostics.AddError(
+			"Unable to pull docker image",
+			"Could not pull docker image "+pullReference+", unexpected error: "+err.Error(),
+		)
+		return
 	}
-}
 
-func parseDockerDaemonJsonMessages(r io.Reader) (dockertypes.BuildResult, error) {
-	var result dockertypes.BuildResult
-	decoder := json.NewDecoder(r)
-	for {
-		var jsonMessage jsonmessage.JSONMessage
-		if err := decoder.Decode(&jsonMessage); err != nil {
-			if err == io.EOF {
-				break
-			}
-			return result, err
-		}
-		if err := jsonMessage.Error; err != nil {
-			return result, err
+	checkTagOverwrite(r, ctx, plan.Overwrite, plan.Tags, imageInspect.ID, diagnostics)
+	if diagnostics.HasError() {
+		return
+	}
+
+	for _, tag := range plan.Tags {
+		repoTag := tag.Repository.ValueString() + ":" + tag.Tag.ValueString()
+		err := retryOnTransientError(ctx, r.retry, "image tag", func() error {
+			return r.client.ImageTag(ctx, imageInspect.ID, repoTag)
+		})
+		if err != nil {
+			diagnostics.AddError(
+				"Unable to tag docker image",
+				"Could not tag docker image as "+repoTag+", unexpected error: "+err.Error(),
+			)
+			return
 		}
-		if jsonMessage.Aux != nil {
-			var r dockertypes.BuildResult
-			if err := json.Unmarshal(*jsonMessage.Aux, &r); err != nil {
-				// logrus.Warnf("Failed to unmarshal aux message. Cause: %s", err)
-			} else {
-				result.ID = r.ID
-			}
+	}
+
+	plan.ID = types.StringValue(imageInspect.ID)
+	plan.Created = types.StringValue(imageInspect.Created)
+	plan.RepoDigest = repoDigest(imageInspect, plan.Tags)
+	plan.SizeBytes = types.Int64Value(imageInspect.Size)
+	plan.Architecture = types.StringValue(imageInspect.Architecture)
+	plan.OS = types.StringValue(imageInspect.Os)
+	plan.Variant = types.StringValue(imageInspect.Variant)
+	plan.ContextHash = types.StringNull()
+
+	config, diags := imageConfig(ctx, imageInspect)
+	diagnostics.Append(diags...)
+	plan.ImageConfig = config
+
+	plan.BuildLog = types.StringNull()
+	plan.BaseImageDigests = types.MapNull(types.StringType)
+
+	// The pulled image has a digest for the repository it was pulled from
+	for _, item := range imageInspect.RepoDigests {
+		repository, _, err := splitRepoDigest(item)
+		if err == nil && sameRepository(repository, pullReference) {
+			plan.RepoDigest = types.StringValue(item)
 		}
 	}
-	return result, nil
 }
 
-func imageBuild(r *imageResource, ctx context.Context, planDir string, dockerFileName string, planTags []tagModel, planPlatform string) (dockertypes.ImageBuildResponse, error) {
+// pullImage pulls the image at ref for platform, if set, with the registry
+// credentials of the provider.
+func pullImage(r *imageResource, ctx context.Context, ref string, platform string) (dockertypes.ImageInspect, error) {
+	registryAuth, err := registryAuthForImage(ctx, r.registryAuths, r.insecureRegistries, r.configDir, ref)
+	if err != nil {
+		return dockertypes.ImageInspect{}, err
+	}
+
+	err = retryOnTransientError(ctx, r.retry, "image pull", func() error {
+		pullResponse, err := r.client.ImagePull(ctx, ref, image.PullOptions{
+			Platform:     platform,
+			RegistryAuth: registryAuth,
+		})
+		if err != nil {
+			return err
+		}
+		defer pullResponse.Close()
 
-	// Defaults if not declared in terraform plan
-	dir := "."
-	if planDir != "" {
-		dir = planDir
+		_, err = parseDockerDaemonJsonMessages(ctx, pullResponse, io.Discard)
+		return err
+	})
+	if err != nil {
+		return dockertypes.ImageInspect{}, err
 	}
 
-	buf := new(bytes.Buffer)
-	tw := tar.NewWriter(buf)
-	defer tw.Close()
+	return inspectImage(r, ctx, ref)
+}
 
-	traverseDirectoryAddFileToTar(ctx, tw, dir)
+// registryDigest returns the digest that the registry currently serves for
+// reference, with the registry credentials of the provider.
+func registryDigest(r *imageResource, ctx context.Context, reference string) (string, error) {
+	registryAuth, err := registryAuthForImage(ctx, r.registryAuths, r.insecureRegistries, r.configDir, reference)
+	if err != nil {
+		return "", err
+	}
 
-	buildContext := bytes.NewReader(buf.Bytes())
+	var digest string
+	err = retryOnTransientError(ctx, r.retry, "distribution inspect", func() error {
+		distributionInspect, err := r.client.DistributionInspect(ctx, reference, registryAuth)
+		if err != nil {
+			return err
+		}
+		digest = distributionInspect.Descriptor.Digest.String()
+		return nil
+	})
 
-	// buildContext := createTarFromDir(dir, ctx)
+	return digest, err
+}
 
-	dockerFile := "Dockerfile"
-	if dockerFileName != "" {
-		dockerFile = dockerFileName
+// resolveBaseImageDigests maps each base image to the digest that the build
+// is pinned to: the digest of its FROM line, its digest in pinned, or else, if
+// fromRegistry is set, the digest that its registry currently serves, which
+// planBaseImageUpdates compares against. Other base images, and those whose
+// digest cannot be read from a registry, e.g. images that only exist in the
+// daemon, are left out and used as they are. An error is returned if a pinned
+// base image is not referenced by the Dockerfile, or is referenced by another
+// digest.
+func resolveBaseImageDigests(r *imageResource, ctx context.Context, pinned []baseImageModel, baseImages []string, fromRegistry bool) (map[string]string, error) {
+	digests := map[string]string{}
+
+	for _, baseImage := range pinned {
+		reference := baseImage.Reference.ValueString()
+		if !slices.Contains(baseImages, reference) {
+			return nil, fmt.Errorf("%s is not referenced by a FROM line in the Dockerfile", reference)
+		}
+		digests[reference] = baseImage.Digest.ValueString()
 	}
 
-	platform := ""
-	if planPlatform != "" {
-		platform = planPlatform
-	}
+	for _, reference := range baseImages {
+		if _, digest, err := splitRepoDigest(reference); err == nil {
+			if pinnedDigest, ok := digests[reference]; ok && pinnedDigest != digest {
+				return nil, fmt.Errorf("%s is pinned to %s but its FROM line references %s", reference, pinnedDigest, digest)
+			}
+			digests[reference] = digest
+			continue
+		}
+		if _, ok := digests[reference]; ok || !fromRegistry {
+			continue
+		}
 
-	// Assign tags
-	tags := []string{}
-	for _, item := range planTags {
-		imageTagName := item.Repository.ValueString() + string(":") + item.Tag.ValueString()
-		tags = append(tags, imageTagName)
+		digest, err := registryDigest(r, ctx, reference)
+		if err != nil {
+			tflog.Debug(ctx, "Unable to resolve digest of base image "+reference+": "+err.Error())
+			continue
+		}
+		digests[reference] = digest
 	}
 
-	tflog.Debug(ctx, "Starting Image Build")
+	return digests, nil
+}
 
-	buildResponse, err := r.client.ImageBuild(
-		ctx,
-		buildContext,
-		dockertypes.ImageBuildOptions{
-			Context:    buildContext,
-			Dockerfile: dockerFile,
-			Tags:       tags,
-			Remove:     true,
-			Platform:   platform,
-			NoCache:    true,
-			PullParent: true,
-		})
+// pinDockerfileBaseImages rewrites the FROM lines of dockerFile to reference
+// the base images in digests by digest, e.g. golang:1.22@sha256:..., so that
+// the builder does not resolve their tags again.
+func pinDockerfileBaseImages(dockerFile string, digests map[string]string) string {
+	lines := strings.Split(dockerFile, "\n")
+	stageNames := map[string]bool{"scratch": true}
+
+	for i, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || !strings.EqualFold(fields[0], "FROM") {
+			continue
+		}
 
-	return buildResponse, err
+		// Skips flags such as --platform=linux/amd64
+		args := []int{}
+		for j, field := range fields {
+			if j > 0 && !strings.HasPrefix(field, "--") {
+				args = append(args, j)
+			}
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		reference := fields[args[0]]
+		digest, ok := digests[reference]
+		if ok && !stageNames[strings.ToLower(reference)] && !strings.Contains(reference, "@") {
+			fields[args[0]] = reference + "@" + digest
+			lines[i] = strings.Join(fields, " ")
+		}
+
+		if len(args) == 3 && strings.EqualFold(fields[args[1]], "AS") {
+			stageNames[strings.ToLower(fields[args[2]])] = true
+		}
+	}
+
+	return strings.Join(lines, "\n")
 }
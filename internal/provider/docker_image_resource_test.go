@@ -5,8 +5,16 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
 	"strconv"
+	"strings"
 	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/tfsdk"
+	"github.com/hashicorp/terraform-plugin-go/tftypes"
 )
 
 // TestHelloName calls greetings.Hello with a name, checking
@@ -20,7 +28,10 @@ func TestDirTraversalUnnested(t *testing.T) {
 	defer tw.Close()
 
 	expectedDirFileCount := 3
-	discoveredDirFileCount := traverseDirectoryAddFileToTar(ctx, tw, "../../tests/docker_image_resource_test/unnested")
+	discoveredDirFileCount, err := traverseDirectoryAddFileToTar(ctx, tw, "../../tests/docker_image_resource_test/unnested")
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	fmt.Println(discoveredDirFileCount)
 
@@ -41,7 +52,10 @@ func TestDirTraversalNested(t *testing.T) {
 	defer tw.Close()
 
 	expectedDirFileCount := 23
-	discoveredDirFileCount := traverseDirectoryAddFileToTar(ctx, tw, "../../tests/docker_image_resource_test/nested")
+	discoveredDirFileCount, err := traverseDirectoryAddFileToTar(ctx, tw, "../../tests/docker_image_resource_test/nested")
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	fmt.Println(discoveredDirFileCount)
 
@@ -50,3 +64,291 @@ func TestDirTraversalNested(t *testing.T) {
 		t.Fatalf("%s", errorMessage)
 	}
 }
+
+// TestParseDockerfileBaseImages checks that FROM lines are resolved to base
+// images, skipping scratch and references to earlier stages.
+func TestParseDockerfileBaseImages(t *testing.T) {
+
+	dockerFile := `# syntax=docker/dockerfile:1
+FROM --platform=linux/amd64 golang:1.22 AS builder
+RUN go build -o /app .
+
+FROM builder AS test
+RUN go test ./...
+
+from scratch
+COPY --from=builder /app /app
+
+FROM gcr.io/distroless/base@sha256:6a5e
+`
+
+	expectedBaseImages := []string{"golang:1.22", "gcr.io/distroless/base@sha256:6a5e"}
+	discoveredBaseImages := parseDockerfileBaseImages(dockerFile)
+
+	if strings.Join(expectedBaseImages, ",") != strings.Join(discoveredBaseImages, ",") {
+		t.Fatalf("Base images are incorrect! Expected %v but found %v.", expectedBaseImages, discoveredBaseImages)
+	}
+}
+
+// TestPinDockerfileBaseImages checks that FROM lines reference base images by
+// digest, leaving stages, scratch and references pinned by digest as they are.
+func TestPinDockerfileBaseImages(t *testing.T) {
+
+	dockerFile := `FROM --platform=linux/amd64 golang:1.22 AS builder
+FROM builder AS test
+FROM scratch
+FROM gcr.io/distroless/base@sha256:6a5e
+`
+	digests := map[string]string{
+		"golang:1.22":                        "sha256:1b2c",
+		"gcr.io/distroless/base@sha256:6a5e": "sha256:6a5e",
+	}
+
+	expectedDockerFile := `FROM --platform=linux/amd64 golang:1.22@sha256:1b2c AS builder
+FROM builder AS test
+FROM scratch
+FROM gcr.io/distroless/base@sha256:6a5e
+`
+	pinnedDockerFile := pinDockerfileBaseImages(dockerFile, digests)
+
+	if pinnedDockerFile != expectedDockerFile {
+		t.Fatalf("Pinned Dockerfile is incorrect! Expected %q but found %q.", expectedDockerFile, pinnedDockerFile)
+	}
+}
+
+// TestAddFileToTarKeepsModesAndSymlinks checks that executables keep their
+// mode and that symlinks are added as links.
+func TestAddFileToTarKeepsModesAndSymlinks(t *testing.T) {
+
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "entrypoint.sh"), []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("entrypoint.sh", filepath.Join(dir, "start")); err != nil {
+		t.Skipf("Unable to create symlink: %s", err)
+	}
+
+	contextTar, err := buildContextTar(ctx, dir, "Dockerfile", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(bytes.NewReader(contextTar))
+	headers := map[string]*tar.Header{}
+	for {
+		header, err := tr.Next()
+		if err != nil {
+			break
+		}
+		headers[header.Name] = header
+	}
+
+	if header := headers["entrypoint.sh"]; header == nil || header.Mode&0o111 == 0 {
+		t.Fatalf("entrypoint.sh is not executable in the build context: %+v", header)
+	}
+	if header := headers["start"]; header == nil || header.Typeflag != tar.TypeSymlink || header.Linkname != "entrypoint.sh" {
+		t.Fatalf("start is not a symlink to entrypoint.sh in the build context: %+v", header)
+	}
+}
+
+// TestBuildContextTarExcludes checks that excludes and .dockerignore leave
+// paths out of the build context, but never the Dockerfile.
+func TestBuildContextTarExcludes(t *testing.T) {
+
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	for _, name := range []string{"Dockerfile", "main.go", ".terraform/state", "dist/app", "dist/keep.txt", "debug.log"} {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, ".dockerignore"), []byte("*.log\nDockerfile\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	excludes, err := contextExcludes(dir, "Dockerfile", []string{".terraform/", "dist/", "!dist/keep.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	contextTar, err := buildContextTar(ctx, dir, "Dockerfile", "", excludes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(bytes.NewReader(contextTar))
+	files := []string{}
+	for {
+		header, err := tr.Next()
+		if err != nil {
+			break
+		}
+		if header.Typeflag == tar.TypeReg {
+			files = append(files, header.Name)
+		}
+	}
+	slices.Sort(files)
+
+	expectedFiles := []string{".dockerignore", "Dockerfile", "dist/keep.txt", "main.go"}
+	if !slices.Equal(expectedFiles, files) {
+		t.Fatalf("Build context is incorrect! Expected %v but found %v.", expectedFiles, files)
+	}
+}
+
+// TestBuildContextTarInvalidExcludes checks that an invalid excludes pattern
+// fails the build context, as it does for BuildKit, rather than being ignored.
+func TestBuildContextTarInvalidExcludes(t *testing.T) {
+
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM scratch\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := buildContextTar(ctx, dir, "Dockerfile", "", []string{"[a-"})
+	if err == nil {
+		t.Fatalf("Invalid excludes were accepted!")
+	}
+}
+
+// TestValidatePlatform checks that platforms are accepted in the form
+// os[/arch[/variant]] with known values only.
+func TestValidatePlatform(t *testing.T) {
+
+	for _, platform := range []string{"linux", "linux/amd64", "linux/arm64/v8", "windows/amd64"} {
+		if err := validatePlatform(platform); err != nil {
+			t.Fatalf("Platform %s is valid but was rejected: %s", platform, err)
+		}
+	}
+
+	for _, platform := range []string{"", "linux/", "amd64", "linux/x86_64", "linux/amd64/v8", "linux/386/v1", "linux/arm/v7/extra"} {
+		if err := validatePlatform(platform); err == nil {
+			t.Fatalf("Platform %q is invalid but was accepted.", platform)
+		}
+	}
+}
+
+// TestSplitRepoTag checks that registry ports are not mistaken for tags.
+func TestSplitRepoTag(t *testing.T) {
+
+	tests := map[string][2]string{
+		"alpine:3.20":                  {"alpine", "3.20"},
+		"registry.local:5000/app:v1":   {"registry.local:5000/app", "v1"},
+		"registry.local:5000/team/app": {"registry.local:5000/team/app", "latest"},
+		"docker.io/library/nginx:1.27": {"nginx", "1.27"},
+	}
+
+	for repoTag, expected := range tests {
+		repository, tag, err := splitRepoTag(repoTag)
+		if err != nil {
+			t.Fatalf("Unable to split %s: %s", repoTag, err)
+		}
+		if repository != expected[0] || tag != expected[1] {
+			t.Fatalf("%s split incorrectly! Expected %s and %s but found %s and %s.", repoTag, expected[0], expected[1], repository, tag)
+		}
+	}
+
+	if _, _, err := splitRepoTag("alpine@sha256:4bcff63911fcb4448bd4fdacec207030997caf25e9bea4045fa6c8c44de311d1"); err == nil {
+		t.Fatalf("Digest reference was split as a repo tag.")
+	}
+}
+
+// TestParseBuildArgFile checks that dotenv-style files are parsed like the
+// env_file of compose.
+func TestParseBuildArgFile(t *testing.T) {
+
+	t.Setenv("FROM_ENV", "env value")
+
+	name := filepath.Join(t.TempDir(), "build.env")
+	content := `# Comment
+VERSION=1.2.3
+export REGISTRY = registry.local:5000
+GREETING="hello\nworld"
+LITERAL='a\nb'
+TRAILING=value # comment
+EMPTY=
+FROM_ENV
+`
+	if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	buildArgs, err := parseBuildArgFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"VERSION":  "1.2.3",
+		"REGISTRY": "registry.local:5000",
+		"GREETING": "hello\nworld",
+		"LITERAL":  `a\nb`,
+		"TRAILING": "value",
+		"EMPTY":    "",
+		"FROM_ENV": "env value",
+	}
+	if fmt.Sprint(buildArgs) != fmt.Sprint(expected) {
+		t.Fatalf("Build arguments are incorrect! Expected %v but found %v.", expected, buildArgs)
+	}
+}
+
+// testImageConfig returns a configuration of docker_image in which the
+// attributes of values are set and all others are null.
+func testImageConfig(t *testing.T, values map[string]tftypes.Value) tfsdk.Config {
+	ctx := context.Background()
+
+	schemaResp := &resource.SchemaResponse{}
+	NewImageResource().Schema(ctx, resource.SchemaRequest{}, schemaResp)
+
+	objectType := schemaResp.Schema.Type().TerraformType(ctx).(tftypes.Object)
+	attributes := map[string]tftypes.Value{}
+	for name, attributeType := range objectType.AttributeTypes {
+		attributes[name] = tftypes.NewValue(attributeType, nil)
+		if value, ok := values[name]; ok {
+			attributes[name] = value
+		}
+	}
+
+	return tfsdk.Config{
+		Schema: schemaResp.Schema,
+		Raw:    tftypes.NewValue(objectType, attributes),
+	}
+}
+
+// TestValidateConfigPull checks that the attributes that configure a build
+// are rejected with pull when planning, unless they are not known yet.
+func TestValidateConfigPull(t *testing.T) {
+
+	pull := tftypes.NewValue(tftypes.Object{AttributeTypes: map[string]tftypes.Type{"reference": tftypes.String}}, map[string]tftypes.Value{
+		"reference": tftypes.NewValue(tftypes.String, "nginx:1.27"),
+	})
+
+	config := testImageConfig(t, map[string]tftypes.Value{
+		"pull":       pull,
+		"dir":        tftypes.NewValue(tftypes.String, "app"),
+		"target":     tftypes.NewValue(tftypes.String, tftypes.UnknownValue),
+		"build_args": tftypes.NewValue(tftypes.Map{ElementType: tftypes.String}, map[string]tftypes.Value{}),
+		"nocache":    tftypes.NewValue(tftypes.Bool, false),
+	})
+
+	resp := &resource.ValidateConfigResponse{}
+	(&imageResource{}).ValidateConfig(context.Background(), resource.ValidateConfigRequest{Config: config}, resp)
+
+	rejected := []string{}
+	for _, diagnostic := range resp.Diagnostics.Errors() {
+		rejected = append(rejected, diagnostic.Detail())
+	}
+
+	expectedRejected := []string{
+		"dir cannot be used with pull, as the image is not built.",
+		"nocache cannot be used with pull, as the image is not built.",
+	}
+	if !slices.Equal(expectedRejected, rejected) {
+		t.Fatalf("Rejected attributes are incorrect! Expected %v but found %v.", expectedRejected, rejected)
+	}
+}
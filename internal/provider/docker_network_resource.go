@@ -0,0 +1,462 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/boolplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/int64planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/listplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/mapplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+const (
+	// overlayNetworkDriver is the driver of the networks of a Swarm.
+	overlayNetworkDriver = "overlay"
+
+	// encryptedNetworkOption is the driver option that encrypts the traffic
+	// of an overlay network, as set by docker network create --opt encrypted.
+	encryptedNetworkOption = "encrypted"
+
+	// mtuNetworkOption is the driver option that sets the MTU of the
+	// interfaces of a bridge or overlay network.
+	mtuNetworkOption = "com.docker.network.driver.mtu"
+)
+
+// minimumMTU is the smallest MTU of an IPv4 link.
+const minimumMTU = 68
+
+// Ensure the implementation satisfies the expected interfaces.
+var (
+	_ resource.Resource              = &networkResource{}
+	_ resource.ResourceWithConfigure = &networkResource{}
+)
+
+// NewNetworkResource is a helper function to simplify the provider implementation.
+func NewNetworkResource() resource.Resource {
+	return &networkResource{}
+}
+
+// networkResource is the resource implementation.
+type networkResource struct {
+	client *client.Client
+	retry  retryConfig
+}
+
+// Metadata returns the resource type name.
+func (r *networkResource) Metadata(_ context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_network"
+}
+
+type networkResourceModel struct {
+	ID         types.String       `tfsdk:"id"`
+	Name       types.String       `tfsdk:"name"`
+	Driver     types.String       `tfsdk:"driver"`
+	Internal   types.Bool         `tfsdk:"internal"`
+	Attachable types.Bool         `tfsdk:"attachable"`
+	Ingress    types.Bool         `tfsdk:"ingress"`
+	Encrypted  types.Bool         `tfsdk:"encrypted"`
+	IPv6       types.Bool         `tfsdk:"ipv6"`
+	Options    types.Map          `tfsdk:"options"`
+	MTU        types.Int64        `tfsdk:"mtu"`
+	Labels     types.Map          `tfsdk:"labels"`
+	IPAMDriver types.String       `tfsdk:"ipam_driver"`
+	IPAMConfig []networkIPAMModel `tfsdk:"ipam_config"`
+}
+
+type networkIPAMModel struct {
+	Subnet     types.String `tfsdk:"subnet"`
+	IPRange    types.String `tfsdk:"ip_range"`
+	Gateway    types.String `tfsdk:"gateway"`
+	AuxAddress types.Map    `tfsdk:"aux_address"`
+}
+
+// Schema defines the schema for the resource.
+func (r *networkResource) Schema(_ context.Context, _ resource.SchemaRequest, resp *resource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		Description: "Creates a user-defined network, like docker network create. Overlay networks are scoped to the Swarm and require a daemon that is a Swarm manager. Networks cannot be changed once created, so any change creates the network again, which fails while containers are connected to it.",
+		Attributes: map[string]schema.Attribute{
+			"id": schema.StringAttribute{
+				Description: "ID of the network.",
+				Computed:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"name": schema.StringAttribute{
+				Description: "Name of the network.",
+				Required:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"driver": schema.StringAttribute{
+				Description: "Driver of the network, e.g. \"bridge\" or \"macvlan\". Defaults to the default driver of the daemon, bridge.",
+				Optional:    true,
+				Computed:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"internal": schema.BoolAttribute{
+				Description: "Restrict external access to the network, so that its containers can only reach each other.",
+				Optional:    true,
+				PlanModifiers: []planmodifier.Bool{
+					boolplanmodifier.RequiresReplace(),
+				},
+			},
+			"attachable": schema.BoolAttribute{
+				Description: "Allow standalone containers, and not only Swarm services, to attach to an overlay network.",
+				Optional:    true,
+				PlanModifiers: []planmodifier.Bool{
+					boolplanmodifier.RequiresReplace(),
+				},
+			},
+			"ingress": schema.BoolAttribute{
+				Description: "Create the overlay network that provides the routing mesh of the Swarm, in place of the default ingress network, which must be removed first. Requires driver = \"overlay\".",
+				Optional:    true,
+				PlanModifiers: []planmodifier.Bool{
+					boolplanmodifier.RequiresReplace(),
+				},
+			},
+			"encrypted": schema.BoolAttribute{
+				Description: "Encrypt the traffic between the nodes of an overlay network with IPsec. Requires driver = \"overlay\".",
+				Optional:    true,
+				PlanModifiers: []planmodifier.Bool{
+					boolplanmodifier.RequiresReplace(),
+				},
+			},
+			"ipv6": schema.BoolAttribute{
+				Description: "Enable IPv6 on the network. Set an IPv6 subnet in ipam_config unless the daemon has default-address-pools for IPv6.",
+				Optional:    true,
+				PlanModifiers: []planmodifier.Bool{
+					boolplanmodifier.RequiresReplace(),
+				},
+			},
+			"options": schema.MapAttribute{
+				Description: "Options of the network driver, like docker network create --opt, e.g. \"com.docker.network.bridge.name\" to name the bridge interface on the host.",
+				ElementType: types.StringType,
+				Optional:    true,
+				PlanModifiers: []planmodifier.Map{
+					mapplanmodifier.RequiresReplace(),
+				},
+			},
+			"mtu": schema.Int64Attribute{
+				Description: "MTU of the interfaces of a bridge or overlay network, e.g. 1450 on hosts whose network has a smaller MTU than 1500. Sets the " + mtuNetworkOption + " option.",
+				Optional:    true,
+				PlanModifiers: []planmodifier.Int64{
+					int64planmodifier.RequiresReplace(),
+				},
+			},
+			"labels": schema.MapAttribute{
+				Description: "Labels of the network.",
+				ElementType: types.StringType,
+				Optional:    true,
+				PlanModifiers: []planmodifier.Map{
+					mapplanmodifier.RequiresReplace(),
+				},
+			},
+			"ipam_driver": schema.StringAttribute{
+				Description: "IPAM driver that allocates the addresses of the network. Defaults to \"default\".",
+				Optional:    true,
+				Computed:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+		},
+		Blocks: map[string]schema.Block{
+			"ipam_config": schema.ListNestedBlock{
+				Description: "Address pools of the network. The IPAM driver allocates a subnet if there are none.",
+				PlanModifiers: []planmodifier.List{
+					listplanmodifier.RequiresReplace(),
+				},
+				NestedObject: schema.NestedBlockObject{
+					Attributes: map[string]schema.Attribute{
+						"subnet": schema.StringAttribute{
+							Description: "Subnet of the pool in CIDR notation, e.g. \"172.28.0.0/16\".",
+							Optional:    true,
+							Validators: []validator.String{
+								cidrValidator{},
+							},
+						},
+						"ip_range": schema.StringAttribute{
+							Description: "Range of subnet in CIDR notation that addresses of containers are allocated from, e.g. \"172.28.5.0/24\".",
+							Optional:    true,
+							Validators: []validator.String{
+								cidrValidator{},
+							},
+						},
+						"gateway": schema.StringAttribute{
+							Description: "Gateway address of subnet, e.g. \"172.28.0.1\".",
+							Optional:    true,
+						},
+						"aux_address": schema.MapAttribute{
+							Description: "Addresses of subnet that are reserved for other hosts, by host name.",
+							ElementType: types.StringType,
+							Optional:    true,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// Create creates the resource and sets the initial Terraform state.
+func (r *networkResource) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
+	var plan networkResourceModel
+	diags := req.Plan.Get(ctx, &plan)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	// Only overlay networks span the nodes of a Swarm
+	if plan.Driver.ValueString() != overlayNetworkDriver {
+		if plan.Ingress.ValueBool() {
+			resp.Diagnostics.AddAttributeError(
+				path.Root("ingress"),
+				"Invalid network driver",
+				"Could not create docker network "+plan.Name.ValueString()+", as ingress requires driver = \""+overlayNetworkDriver+"\".",
+			)
+		}
+		if plan.Encrypted.ValueBool() {
+			resp.Diagnostics.AddAttributeError(
+				path.Root("encrypted"),
+				"Invalid network driver",
+				"Could not create docker network "+plan.Name.ValueString()+", as encrypted requires driver = \""+overlayNetworkDriver+"\".",
+			)
+		}
+	}
+
+	labels := map[string]string{}
+	resp.Diagnostics.Append(plan.Labels.ElementsAs(ctx, &labels, false)...)
+
+	options := map[string]string{}
+	resp.Diagnostics.Append(plan.Options.ElementsAs(ctx, &options, false)...)
+	if !plan.MTU.IsNull() {
+		if _, ok := options[mtuNetworkOption]; ok {
+			resp.Diagnostics.AddAttributeError(
+				path.Root("mtu"),
+				"Conflicting network options",
+				"Could not create docker network "+plan.Name.ValueString()+", as mtu and the "+mtuNetworkOption+" option are both set. Set only one of them.",
+			)
+		}
+		if plan.MTU.ValueInt64() < minimumMTU {
+			resp.Diagnostics.AddAttributeError(
+				path.Root("mtu"),
+				"Invalid MTU",
+				fmt.Sprintf("Could not create docker network %s, as mtu must be at least %d, got: %d.", plan.Name.ValueString(), minimumMTU, plan.MTU.ValueInt64()),
+			)
+		}
+		options[mtuNetworkOption] = strconv.FormatInt(plan.MTU.ValueInt64(), 10)
+	}
+	if plan.Encrypted.ValueBool() {
+		options[encryptedNetworkOption] = ""
+	}
+
+	ipam := &network.IPAM{Driver: plan.IPAMDriver.ValueString()}
+	for _, ipamConfig := range plan.IPAMConfig {
+		auxAddress := map[string]string{}
+		resp.Diagnostics.Append(ipamConfig.AuxAddress.ElementsAs(ctx, &auxAddress, false)...)
+
+		ipam.Config = append(ipam.Config, network.IPAMConfig{
+			Subnet:     ipamConfig.Subnet.ValueString(),
+			IPRange:    ipamConfig.IPRange.ValueString(),
+			Gateway:    ipamConfig.Gateway.ValueString(),
+			AuxAddress: auxAddress,
+		})
+	}
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	createOptions := network.CreateOptions{
+		Driver:     plan.Driver.ValueString(),
+		Internal:   plan.Internal.ValueBool(),
+		Attachable: plan.Attachable.ValueBool(),
+		Ingress:    plan.Ingress.ValueBool(),
+		Options:    options,
+		Labels:     labels,
+		IPAM:       ipam,
+	}
+	// Unset, the daemon decides, e.g. from the default-network-opts of its
+	// configuration
+	if !plan.IPv6.IsNull() {
+		createOptions.EnableIPv6 = plan.IPv6.ValueBoolPointer()
+	}
+
+	createResponse, err := r.client.NetworkCreate(ctx, plan.Name.ValueString(), createOptions)
+	if err != nil {
+		tflog.Debug(ctx, "Unable to create docker network")
+		tflog.Debug(ctx, err.Error())
+
+		resp.Diagnostics.AddError(
+			"Unable to create docker network",
+			"Could not create docker network "+plan.Name.ValueString()+", unexpected error: "+err.Error(),
+		)
+		return
+	}
+	if createResponse.Warning != "" {
+		resp.Diagnostics.AddWarning("Docker network created with warnings", createResponse.Warning)
+	}
+
+	networkInspect, err := r.client.NetworkInspect(ctx, createResponse.ID, network.InspectOptions{})
+	if err != nil {
+		resp.Diagnostics.AddError(
+			"Unable to read docker network",
+			"Could not read created docker network "+plan.Name.ValueString()+", unexpected error: "+err.Error(),
+		)
+		return
+	}
+
+	plan.ID = types.StringValue(networkInspect.ID)
+	plan.Driver = types.StringValue(networkInspect.Driver)
+	plan.IPAMDriver = types.StringValue(networkInspect.IPAM.Driver)
+
+	// Set state to fully populated data
+	diags = resp.State.Set(ctx, &plan)
+	resp.Diagnostics.Append(diags...)
+}
+
+// Read refreshes the Terraform state with the latest data.
+// The network is created again if it was removed outside of Terraform.
+func (r *networkResource) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
+	var state networkResourceModel
+	diags := req.State.Get(ctx, &state)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	var networkInspect network.Inspect
+	err := retryOnTransientError(ctx, r.retry, "network inspect", func() error {
+		var err error
+		networkInspect, err = r.client.NetworkInspect(ctx, state.ID.ValueString(), network.InspectOptions{})
+		return err
+	})
+	if errdefs.IsNotFound(err) {
+		resp.State.RemoveResource(ctx)
+		return
+	}
+	if err != nil {
+		resp.Diagnostics.AddError(
+			"Unable to read docker network",
+			"Could not read docker network "+state.Name.ValueString()+", unexpected error: "+err.Error(),
+		)
+		return
+	}
+
+	state.Name = types.StringValue(networkInspect.Name)
+	state.Driver = types.StringValue(networkInspect.Driver)
+	state.IPAMDriver = types.StringValue(networkInspect.IPAM.Driver)
+	if !state.Internal.IsNull() || networkInspect.Internal {
+		state.Internal = types.BoolValue(networkInspect.Internal)
+	}
+	if !state.Attachable.IsNull() || networkInspect.Attachable {
+		state.Attachable = types.BoolValue(networkInspect.Attachable)
+	}
+	if !state.Ingress.IsNull() || networkInspect.Ingress {
+		state.Ingress = types.BoolValue(networkInspect.Ingress)
+	}
+	_, encrypted := networkInspect.Options[encryptedNetworkOption]
+	if !state.Encrypted.IsNull() || encrypted {
+		state.Encrypted = types.BoolValue(encrypted)
+	}
+	if !state.IPv6.IsNull() {
+		state.IPv6 = types.BoolValue(networkInspect.EnableIPv6)
+	}
+	if mtu, err := strconv.ParseInt(networkInspect.Options[mtuNetworkOption], 10, 64); err == nil && !state.MTU.IsNull() {
+		state.MTU = types.Int64Value(mtu)
+	}
+
+	// Drivers add options of their own, e.g. the VXLAN IDs of overlay
+	// networks, so only the configured options are refreshed
+	if !state.Options.IsNull() {
+		options := map[string]string{}
+		resp.Diagnostics.Append(state.Options.ElementsAs(ctx, &options, false)...)
+		for key := range options {
+			if value, ok := networkInspect.Options[key]; ok {
+				options[key] = value
+			} else {
+				delete(options, key)
+			}
+		}
+		state.Options, diags = types.MapValueFrom(ctx, types.StringType, options)
+		resp.Diagnostics.Append(diags...)
+	}
+	if !state.Labels.IsNull() || len(networkInspect.Labels) > 0 {
+		state.Labels, diags = types.MapValueFrom(ctx, types.StringType, networkInspect.Labels)
+		resp.Diagnostics.Append(diags...)
+	}
+
+	diags = resp.State.Set(ctx, &state)
+	resp.Diagnostics.Append(diags...)
+}
+
+// Update updates the resource and sets the updated Terraform state on success.
+func (r *networkResource) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
+}
+
+// Delete deletes the resource and removes the Terraform state on success.
+func (r *networkResource) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
+	var state networkResourceModel
+	diags := req.State.Get(ctx, &state)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	err := retryOnTransientError(ctx, r.retry, "network remove", func() error {
+		return r.client.NetworkRemove(ctx, state.ID.ValueString())
+	})
+	if err != nil && !errdefs.IsNotFound(err) {
+		tflog.Debug(ctx, "Unable to remove docker network")
+		tflog.Debug(ctx, err.Error())
+
+		resp.Diagnostics.AddError(
+			"Unable to remove docker network",
+			"Could not remove docker network "+state.Name.ValueString()+", unexpected error: "+err.Error(),
+		)
+	}
+}
+
+// Configure adds the provider configured client to the resource.
+func (r *networkResource) Configure(_ context.Context, req resource.ConfigureRequest, resp *resource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+
+	providerData, ok := req.ProviderData.(*dockerProviderData)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Resource Configure Type",
+			fmt.Sprintf("Expected *dockerProviderData, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+		)
+
+		return
+	}
+
+	providerData.requireDaemon("docker_network", &resp.Diagnostics)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	r.client = providerData.client
+	r.retry = providerData.retry
+}
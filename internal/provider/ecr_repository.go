@@ -0,0 +1,165 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ecrRegistryPattern matches the address of an Amazon ECR private registry,
+// e.g. 123456789012.dkr.ecr.eu-west-1.amazonaws.com.
+var ecrRegistryPattern = regexp.MustCompile(`^(\d{12})\.dkr\.ecr(-fips)?\.([a-z0-9-]+)\.amazonaws\.com(\.cn)?$`)
+
+// awsCredentials are the credentials that requests to AWS APIs are signed
+// with.
+type awsCredentials struct {
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+}
+
+// isECRRegistry reports whether address is an Amazon ECR private registry.
+func isECRRegistry(address string) bool {
+	return ecrRegistryPattern.MatchString(address)
+}
+
+// createECRRepository creates repository in the ECR registry at address, the
+// same way aws ecr create-repository does. A repository that already exists
+// is not an error. Credentials are read from AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN only, not from the rest of the
+// credential chain of the AWS SDKs, such as profiles and instance roles.
+func createECRRepository(ctx context.Context, httpClient *http.Client, address string, repository string) error {
+	match := ecrRegistryPattern.FindStringSubmatch(address)
+	if match == nil {
+		return fmt.Errorf("%s is not an Amazon ECR registry", address)
+	}
+	accountID, region, suffix := match[1], match[3], match[4]
+
+	credentials := awsCredentials{
+		accessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if credentials.accessKeyID == "" || credentials.secretAccessKey == "" {
+		return fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are required to create ECR repositories, as profiles, SSO, web identity and instance roles are not supported; export their credentials, e.g. with aws configure export-credentials --format env")
+	}
+
+	body, err := json.Marshal(map[string]string{
+		"registryId":     accountID,
+		"repositoryName": repository,
+	})
+	if err != nil {
+		return err
+	}
+
+	host := "api.ecr." + region + ".amazonaws.com" + suffix
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://"+host+"/", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "AmazonEC2ContainerRegistry_V20150921.CreateRepository")
+	signAWSRequest(req, body, credentials, region, "ecr", time.Now().UTC())
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	var apiError struct {
+		Type    string `json:"__type"`
+		Message string `json:"message"`
+	}
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	json.Unmarshal(respBody, &apiError)
+	if strings.HasSuffix(apiError.Type, "RepositoryAlreadyExistsException") {
+		return nil
+	}
+
+	return fmt.Errorf("unable to create ECR repository %s: unexpected status %s: %s %s", repository, resp.Status, apiError.Type, apiError.Message)
+}
+
+// signAWSRequest signs req, whose body is body, with AWS Signature Version 4
+// for service in region.
+func signAWSRequest(req *http.Request, body []byte, credentials awsCredentials, region string, service string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if credentials.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", credentials.sessionToken)
+	}
+
+	// Every header set so far is signed, along with the host
+	headers := map[string]string{"host": req.URL.Host}
+	for key := range req.Header {
+		headers[strings.ToLower(key)] = strings.TrimSpace(req.Header.Get(key))
+	}
+	names := []string{}
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	canonicalHeaders := ""
+	for _, name := range names {
+		canonicalHeaders += name + ":" + headers[name] + "\n"
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.RawQuery,
+		canonicalHeaders,
+		signedHeaders,
+		sha256Hex(body),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+credentials.secretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+credentials.accessKeyID+"/"+scope+", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func sha256Hex(data []byte) string {
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,28 @@
+package provider
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// TestSignAWSRequest checks the signature of the get-vanilla request of the
+// AWS Signature Version 4 test suite.
+func TestSignAWSRequest(t *testing.T) {
+
+	req, err := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	credentials := awsCredentials{
+		accessKeyID:     "AKIDEXAMPLE",
+		secretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	}
+
+	signAWSRequest(req, nil, credentials, "us-east-1", "service", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	expected := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if authorization := req.Header.Get("Authorization"); authorization != expected {
+		t.Fatalf("Authorization is incorrect! Expected %s but found %s.", expected, authorization)
+	}
+}
@@ -0,0 +1,55 @@
+package provider
+
+import (
+	"context"
+	"slices"
+
+	dockertypes "github.com/docker/docker/api/types"
+	"github.com/hashicorp/terraform-plugin-framework/attr"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+// imageConfigAttrTypes are the attribute types of the image_config of
+// docker_image.
+var imageConfigAttrTypes = map[string]attr.Type{
+	"labels":        types.MapType{ElemType: types.StringType},
+	"env":           types.ListType{ElemType: types.StringType},
+	"entrypoint":    types.ListType{ElemType: types.StringType},
+	"cmd":           types.ListType{ElemType: types.StringType},
+	"exposed_ports": types.ListType{ElemType: types.StringType},
+	"working_dir":   types.StringType,
+}
+
+type imageConfigModel struct {
+	Labels       map[string]string `tfsdk:"labels"`
+	Env          []string          `tfsdk:"env"`
+	Entrypoint   []string          `tfsdk:"entrypoint"`
+	Cmd          []string          `tfsdk:"cmd"`
+	ExposedPorts []string          `tfsdk:"exposed_ports"`
+	WorkingDir   string            `tfsdk:"working_dir"`
+}
+
+// imageConfig returns the configuration that containers of the image inherit,
+// as the image_config of docker_image. Exposed ports are sorted, e.g.
+// ["443/tcp", "80/tcp"], as the daemon reports them in no particular order.
+func imageConfig(ctx context.Context, imageInspect dockertypes.ImageInspect) (types.Object, diag.Diagnostics) {
+	if imageInspect.Config == nil {
+		return types.ObjectNull(imageConfigAttrTypes), nil
+	}
+
+	config := imageConfigModel{
+		Labels:       imageInspect.Config.Labels,
+		Env:          imageInspect.Config.Env,
+		Entrypoint:   imageInspect.Config.Entrypoint,
+		Cmd:          imageInspect.Config.Cmd,
+		ExposedPorts: []string{},
+		WorkingDir:   imageInspect.Config.WorkingDir,
+	}
+	for port := range imageInspect.Config.ExposedPorts {
+		config.ExposedPorts = append(config.ExposedPorts, string(port))
+	}
+	slices.Sort(config.ExposedPorts)
+
+	return types.ObjectValueFrom(ctx, imageConfigAttrTypes, config)
+}
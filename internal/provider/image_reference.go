@@ -0,0 +1,81 @@
+package provider
+
+import (
+	"fmt"
+
+	"github.com/distribution/reference"
+)
+
+// splitRepoTag splits a repo tag as reported by the daemon, e.g.
+// "registry.local:5000/app:v1", into its repository and tag. References
+// without a tag have the tag "latest".
+func splitRepoTag(repoTag string) (string, string, error) {
+	named, err := reference.ParseNormalizedNamed(repoTag)
+	if err != nil {
+		return "", "", err
+	}
+	if _, ok := named.(reference.Digested); ok {
+		return "", "", fmt.Errorf("%s is a digest reference, not a repo tag", repoTag)
+	}
+
+	tagged := reference.TagNameOnly(named).(reference.Tagged)
+
+	return reference.FamiliarName(named), tagged.Tag(), nil
+}
+
+// hasTag reports whether image names a tag, e.g. "app:v1" rather than "app".
+func hasTag(image string) bool {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return false
+	}
+	_, ok := named.(reference.Tagged)
+
+	return ok
+}
+
+// splitRepoDigest splits a repo digest as reported by the daemon, e.g.
+// "registry.local:5000/app@sha256:...", into its repository and digest.
+func splitRepoDigest(repoDigest string) (string, string, error) {
+	named, err := reference.ParseNormalizedNamed(repoDigest)
+	if err != nil {
+		return "", "", err
+	}
+
+	canonical, ok := named.(reference.Canonical)
+	if !ok {
+		return "", "", fmt.Errorf("%s is not a digest reference", repoDigest)
+	}
+
+	return reference.FamiliarName(named), canonical.Digest().String(), nil
+}
+
+// sameRepository reports whether two repository names refer to the same
+// repository, e.g. "nginx" and "docker.io/library/nginx".
+func sameRepository(a string, b string) bool {
+	namedA, err := reference.ParseNormalizedNamed(a)
+	if err != nil {
+		return a == b
+	}
+	namedB, err := reference.ParseNormalizedNamed(b)
+	if err != nil {
+		return a == b
+	}
+
+	return namedA.Name() == namedB.Name()
+}
+
+// pullReferenceTag returns the repo tag that the daemon gives an image pulled
+// by pullReference, e.g. "nginx:latest" for "docker.io/library/nginx", or an
+// empty string if it is pulled by digest.
+func pullReferenceTag(pullReference string) string {
+	named, err := reference.ParseNormalizedNamed(pullReference)
+	if err != nil {
+		return ""
+	}
+	if _, ok := named.(reference.Digested); ok {
+		return ""
+	}
+
+	return reference.FamiliarString(reference.TagNameOnly(named))
+}
@@ -0,0 +1,86 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/docker/docker/client"
+)
+
+// isInsecureRegistry reports whether the registry of image is listed in the
+// insecure_registries of the provider.
+func isInsecureRegistry(insecureRegistries map[string]bool, image string) bool {
+	address, err := registryAddressFromImage(image)
+	if err != nil {
+		return false
+	}
+
+	return insecureRegistries[address]
+}
+
+// insecureRegistryWarning returns a warning if the registry of image is
+// listed in insecure_registries but the daemon, which pushes and pulls the
+// image, still expects it to serve a trusted TLS certificate. An empty string
+// is returned otherwise.
+func insecureRegistryWarning(ctx context.Context, c *client.Client, insecureRegistries map[string]bool, image string) (string, error) {
+	if !isInsecureRegistry(insecureRegistries, image) {
+		return "", nil
+	}
+
+	address, err := registryAddressFromImage(image)
+	if err != nil {
+		return "", err
+	}
+
+	insecure, err := daemonTreatsRegistryAsInsecure(ctx, c, address)
+	if err != nil || insecure {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s is listed in insecure_registries, but the Docker daemon does not treat it as insecure and will "+
+		"require HTTPS with a trusted certificate. Add it to \"insecure-registries\" in the daemon.json of the "+
+		"daemon and restart it, see https://docs.docker.com/reference/cli/dockerd/#insecure-registries", address), nil
+}
+
+// daemonTreatsRegistryAsInsecure reports whether the daemon accepts plain
+// HTTP and untrusted certificates from address, either because it is
+// configured in insecure-registries of the daemon or because its IP is in one
+// of the insecure CIDRs, such as 127.0.0.0/8.
+func daemonTreatsRegistryAsInsecure(ctx context.Context, c *client.Client, address string) (bool, error) {
+	info, err := c.Info(ctx)
+	if err != nil {
+		return false, err
+	}
+	if info.RegistryConfig == nil {
+		return false, nil
+	}
+
+	if indexInfo, ok := info.RegistryConfig.IndexConfigs[address]; ok {
+		return !indexInfo.Secure, nil
+	}
+
+	host := address
+	if splitHost, _, err := net.SplitHostPort(address); err == nil {
+		host = splitHost
+	}
+
+	ips := []net.IP{net.ParseIP(host)}
+	if ips[0] == nil {
+		ips, err = net.DefaultResolver.LookupIP(ctx, "ip", host)
+		if err != nil {
+			// The daemon treats registries it cannot resolve as secure
+			return false, nil
+		}
+	}
+
+	for _, cidr := range info.RegistryConfig.InsecureRegistryCIDRs {
+		for _, ip := range ips {
+			if (*net.IPNet)(cidr).Contains(ip) {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
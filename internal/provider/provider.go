@@ -3,12 +3,22 @@ package provider
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"os"
+	"time"
 
+	"github.com/docker/cli/cli/connhelper"
+	"github.com/docker/docker/api/types/registry"
+	"github.com/docker/docker/api/types/versions"
 	"github.com/docker/docker/client"
 	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
 	"github.com/hashicorp/terraform-plugin-framework/provider"
 	"github.com/hashicorp/terraform-plugin-framework/provider/schema"
 	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"golang.org/x/net/http/httpproxy"
 )
 
 // Ensure the implementation satisfies the expected interfaces.
@@ -40,117 +50,550 @@ func (p *dockerProvider) Metadata(_ context.Context, _ provider.MetadataRequest,
 
 func (p *dockerProvider) Schema(_ context.Context, _ provider.SchemaRequest, resp *provider.SchemaResponse) {
 	resp.Schema = schema.Schema{
-		// Attributes: map[string]schema.Attribute{
-		// 	"region": schema.StringAttribute{
-		// 		Optional: true,
-		// 	},
-		// 	"access_key": schema.StringAttribute{
-		// 		Optional: true,
-		// 	},
-		// 	"secret_key": schema.StringAttribute{
-		// 		Optional:  true,
-		// 		Sensitive: true,
-		// 	},
-		// },
+		Attributes: map[string]schema.Attribute{
+			"host": schema.StringAttribute{
+				Description: "Address of the Docker daemon, e.g. tcp://build-host:2376, ssh://user@build-host or npipe:////./pipe/docker_engine on Windows. Defaults to DOCKER_HOST, or the local socket (named pipe on Windows) if unset.",
+				Optional:    true,
+			},
+			"context": schema.StringAttribute{
+				Description: "Name of a Docker context, as created with docker context create, to read the endpoint and TLS material from. host and the TLS attributes take precedence over the context.",
+				Optional:    true,
+			},
+			"config_path": schema.StringAttribute{
+				Description: "Directory holding the docker CLI config.json and contexts, used to read registry credentials stored by docker login and the context. Defaults to DOCKER_CONFIG, or ~/.docker if unset.",
+				Optional:    true,
+			},
+			"ssh_opts": schema.ListAttribute{
+				Description: "Additional options passed to the ssh command when host uses the ssh:// scheme, e.g. [\"-o\", \"StrictHostKeyChecking=no\"].",
+				ElementType: types.StringType,
+				Optional:    true,
+			},
+			"ca_material": schema.StringAttribute{
+				Description: "PEM-encoded CA certificate used to verify the Docker daemon.",
+				Optional:    true,
+			},
+			"cert_material": schema.StringAttribute{
+				Description: "PEM-encoded client certificate used to authenticate with the Docker daemon.",
+				Optional:    true,
+			},
+			"key_material": schema.StringAttribute{
+				Description: "PEM-encoded private key of the client certificate.",
+				Optional:    true,
+				Sensitive:   true,
+			},
+			"cert_path": schema.StringAttribute{
+				Description: "Path to a directory containing ca.pem, cert.pem and key.pem. Values set in ca_material, cert_material and key_material take precedence. Defaults to DOCKER_CERT_PATH.",
+				Optional:    true,
+			},
+			"tls_verify": schema.BoolAttribute{
+				Description: "Specify whether to verify the certificate of the Docker daemon. Defaults to true when TLS is used, except for certificates read from DOCKER_CERT_PATH, which are only verified if DOCKER_TLS_VERIFY is set.",
+				Optional:    true,
+			},
+			"http_proxy": schema.StringAttribute{
+				Description: "Proxy used for http:// connections to the Docker daemon, e.g. http://proxy.example.com:3128.",
+				Optional:    true,
+			},
+			"https_proxy": schema.StringAttribute{
+				Description: "Proxy used for https:// connections to the Docker daemon.",
+				Optional:    true,
+			},
+			"no_proxy": schema.StringAttribute{
+				Description: "Comma-separated list of hosts, domains and CIDRs for which the proxies are not used, e.g. localhost,.internal,10.0.0.0/8.",
+				Optional:    true,
+			},
+			"registry_only": schema.BoolAttribute{
+				Description: "Skip connecting to a Docker daemon, e.g. on machines without Docker installed. Only resources and data sources that talk to registries directly can be used.",
+				Optional:    true,
+			},
+			"user_agent_suffix": schema.StringAttribute{
+				Description: "Appended to the provider User-Agent sent with every request to the daemon and with the requests that the provider makes to registries itself, e.g. to attribute registry traffic to a team or pipeline.",
+				Optional:    true,
+			},
+			"api_version": schema.StringAttribute{
+				Description: "Docker Engine API version to use, e.g. 1.45. The provider fails if the daemon does not support it. Defaults to DOCKER_API_VERSION, or negotiating the version with the daemon if unset.",
+				Optional:    true,
+			},
+			"max_retries": schema.Int64Attribute{
+				Description: "Number of times build, push, inspect and remove calls are retried on transient errors such as dropped connections, timeouts and server errors. Defaults to 0.",
+				Optional:    true,
+			},
+			"retry_delay": schema.StringAttribute{
+				Description: "Delay before the first retry, doubled after each attempt, e.g. \"2s\". Defaults to \"1s\".",
+				Optional:    true,
+			},
+			"connect_timeout": schema.StringAttribute{
+				Description: "Timeout for establishing a connection to the Docker daemon, e.g. \"30s\". Defaults to \"10s\".",
+				Optional:    true,
+			},
+			"request_timeout": schema.StringAttribute{
+				Description: "Timeout for a whole request to the Docker daemon, including reading the response of builds and pushes, e.g. \"1h\". Defaults to no timeout.",
+				Optional:    true,
+			},
+			"keep_alive": schema.StringAttribute{
+				Description: "Interval between TCP keep-alive probes on connections to tcp:// hosts, e.g. \"30s\". \"0s\" disables keep-alive probes. Defaults to \"15s\".",
+				Optional:    true,
+			},
+			"idle_conn_timeout": schema.StringAttribute{
+				Description: "How long an idle connection to the Docker daemon is kept open for reuse, e.g. \"90s\". Defaults to no limit.",
+				Optional:    true,
+			},
+			"insecure_registries": schema.ListAttribute{
+				Description: "Registries, e.g. registry.local:5000, that serve plain HTTP or self-signed certificates. Pushes and pulls from them fall back to anonymous access if no credentials can be read, and a warning is shown if the Docker daemon is not configured to treat them as insecure.",
+				ElementType: types.StringType,
+				Optional:    true,
+			},
+			"debug": schema.BoolAttribute{
+				Description: "Log every Docker Engine API call with its response status and duration at debug level, see TF_LOG.",
+				Optional:    true,
+			},
+			"audit_log_file": schema.StringAttribute{
+				Description: "Path of a file to which every Engine API operation, and every request that the provider makes to registries itself, such as drift checks and docker_image_copy, is appended as a JSON line (operation, target, outcome). The target of registry requests starts with the registry host.",
+				Optional:    true,
+			},
+		},
+		Blocks: map[string]schema.Block{
+			"timeouts": schema.SingleNestedBlock{
+				Description: "Default timeouts of Docker operations, e.g. \"30m\", inherited by resources that do not set their own timeouts. Defaults to no timeout.",
+				Attributes: map[string]schema.Attribute{
+					"build": schema.StringAttribute{
+						Description: "Timeout for building an image, including pulling its base images.",
+						Optional:    true,
+					},
+					"push": schema.StringAttribute{
+						Description: "Timeout for pushing an image.",
+						Optional:    true,
+					},
+					"delete": schema.StringAttribute{
+						Description: "Timeout for removing an image.",
+						Optional:    true,
+					},
+				},
+			},
+			"registry_auth": schema.ListNestedBlock{
+				Description: "Credentials for a registry, used by resources that push or pull images from it.",
+				NestedObject: schema.NestedBlockObject{
+					Attributes: map[string]schema.Attribute{
+						"address": schema.StringAttribute{
+							Description: "Address of the registry, e.g. registry.example.com or docker.io.",
+							Required:    true,
+						},
+						"username": schema.StringAttribute{
+							Description: "Username for the registry.",
+							Optional:    true,
+						},
+						"password": schema.StringAttribute{
+							Description: "Password for the registry.",
+							Optional:    true,
+							Sensitive:   true,
+						},
+						"config_file": schema.StringAttribute{
+							Description: "Path to a docker CLI config.json to read the credentials for address from, instead of username and password.",
+							Optional:    true,
+						},
+						"azure": schema.SingleNestedAttribute{
+							Description: "Obtain a token for an Azure Container Registry with a service principal or managed identity, instead of username and password. Unset values are read from AZURE_TENANT_ID, AZURE_CLIENT_ID and AZURE_CLIENT_SECRET.",
+							Optional:    true,
+							Attributes: map[string]schema.Attribute{
+								"tenant_id": schema.StringAttribute{
+									Description: "Azure AD tenant ID.",
+									Optional:    true,
+								},
+								"client_id": schema.StringAttribute{
+									Description: "Client ID of the service principal, or of a user-assigned managed identity.",
+									Optional:    true,
+								},
+								"client_secret": schema.StringAttribute{
+									Description: "Client secret of the service principal.",
+									Optional:    true,
+									Sensitive:   true,
+								},
+								"managed_identity": schema.BoolAttribute{
+									Description: "Use the managed identity of the host instead of a service principal.",
+									Optional:    true,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
 	}
 }
 
 // dockerProviderModel maps provider schema data to a Go type.
-// type dockerProviderModel struct {
-// 	// Region    types.String `tfsdk:"region"`
-// 	// AccessKey types.String `tfsdk:"access_key"`
-// 	// SecretKey types.String `tfsdk:"secret_key"`
-// }
+type dockerProviderModel struct {
+	Host               types.String        `tfsdk:"host"`
+	Context            types.String        `tfsdk:"context"`
+	ConfigPath         types.String        `tfsdk:"config_path"`
+	SSHOpts            []string            `tfsdk:"ssh_opts"`
+	CaMaterial         types.String        `tfsdk:"ca_material"`
+	CertMaterial       types.String        `tfsdk:"cert_material"`
+	KeyMaterial        types.String        `tfsdk:"key_material"`
+	CertPath           types.String        `tfsdk:"cert_path"`
+	TLSVerify          types.Bool          `tfsdk:"tls_verify"`
+	HTTPProxy          types.String        `tfsdk:"http_proxy"`
+	HTTPSProxy         types.String        `tfsdk:"https_proxy"`
+	NoProxy            types.String        `tfsdk:"no_proxy"`
+	RegistryOnly       types.Bool          `tfsdk:"registry_only"`
+	UserAgentSuffix    types.String        `tfsdk:"user_agent_suffix"`
+	APIVersion         types.String        `tfsdk:"api_version"`
+	MaxRetries         types.Int64         `tfsdk:"max_retries"`
+	RetryDelay         types.String        `tfsdk:"retry_delay"`
+	ConnectTimeout     types.String        `tfsdk:"connect_timeout"`
+	RequestTimeout     types.String        `tfsdk:"request_timeout"`
+	KeepAlive          types.String        `tfsdk:"keep_alive"`
+	IdleConnTimeout    types.String        `tfsdk:"idle_conn_timeout"`
+	Debug              types.Bool          `tfsdk:"debug"`
+	AuditLogFile       types.String        `tfsdk:"audit_log_file"`
+	InsecureRegistries []string            `tfsdk:"insecure_registries"`
+	Timeouts           *timeoutsModel      `tfsdk:"timeouts"`
+	RegistryAuth       []registryAuthModel `tfsdk:"registry_auth"`
+}
+
+type registryAuthModel struct {
+	Address    types.String    `tfsdk:"address"`
+	Username   types.String    `tfsdk:"username"`
+	Password   types.String    `tfsdk:"password"`
+	ConfigFile types.String    `tfsdk:"config_file"`
+	Azure      *azureAuthModel `tfsdk:"azure"`
+}
+
+type azureAuthModel struct {
+	TenantID        types.String `tfsdk:"tenant_id"`
+	ClientID        types.String `tfsdk:"client_id"`
+	ClientSecret    types.String `tfsdk:"client_secret"`
+	ManagedIdentity types.Bool   `tfsdk:"managed_identity"`
+}
+
+// dockerProviderData is made available to data sources and resources in their
+// Configure methods.
+type dockerProviderData struct {
+	// client is nil if the provider is configured with registry_only.
+	client *client.Client
+	// registryAuths holds the credentials of each registry_auth block, keyed
+	// by normalized registry address.
+	registryAuths map[string]registry.AuthConfig
+	// insecureRegistries holds the normalized addresses of
+	// insecure_registries.
+	insecureRegistries map[string]bool
+	// registryTransports carry the requests that the provider makes to
+	// registries itself.
+	registryTransports *registryTransports
+	// configDir is the directory of the docker CLI config.json.
+	configDir string
+	retry     retryConfig
+	timeouts  operationTimeouts
+}
 
 func (p *dockerProvider) Configure(ctx context.Context, req provider.ConfigureRequest, resp *provider.ConfigureResponse) {
+	// Retrieve provider data from configuration
+	var config dockerProviderModel
+	diags := req.Config.Get(ctx, &config)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
 
-	// // Retrieve provider data from configuration
-	// var config dockerProviderModel
-	// diags := req.Config.Get(ctx, &config)
-	// resp.Diagnostics.Append(diags...)
-	// if resp.Diagnostics.HasError() {
-	// 	return
-	// }
-
-	// // if config.Region.IsUnknown() {
-	// // 	resp.Diagnostics.AddAttributeError(
-	// // 		path.Root("region"),
-	// // 		"Unknown Region",
-	// // 		"The provider cannot create the Custom S3 client as there is an unknown configuration value for the AWS Region. ",
-	// // 	)
-	// // }
-	// // if config.AccessKey.IsUnknown() {
-	// // 	resp.Diagnostics.AddAttributeError(
-	// // 		path.Root("access_key"),
-	// // 		"Unknown Access Key value",
-	// // 		"The provider cannot create the Custom S3 client as there is an unknown configuration value for the AWS Access Key. ",
-	// // 	)
-	// // }
-	// // if config.SecretKey.IsUnknown() {
-	// // 	resp.Diagnostics.AddAttributeError(
-	// // 		path.Root("secret_key"),
-	// // 		"Unknown Secret Key value",
-	// // 		"The provider cannot create the Custom S3 client as there is an unknown configuration value for the AWS Secret Key. ",
-	// // 	)
-	// // }
-	// // if resp.Diagnostics.HasError() {
-	// // 	return
-	// // }
-
-	// // region := os.Getenv("AWS_REGION")
-	// // access_key := os.Getenv("AWS_ACCESS_KEY_ID")
-	// // secret_key := os.Getenv("AWS_SECRET_ACCESS_KEY")
-
-	// // if !config.Region.IsNull() {
-	// // 	region = config.Region.ValueString()
-	// // }
-
-	// // if !config.AccessKey.IsNull() {
-	// // 	access_key = config.AccessKey.ValueString()
-	// // }
-
-	// // if !config.SecretKey.IsNull() {
-	// // 	secret_key = config.SecretKey.ValueString()
-	// // }
-
-	// // if region == "" {
-	// // 	resp.Diagnostics.AddAttributeError(
-	// // 		path.Root("region"),
-	// // 		"Missing Region",
-	// // 		"The provider cannot create the AWS client as there is a missing or empty value for the Region. ",
-	// // 	)
-	// // }
-
-	// // if access_key == "" {
-	// // 	resp.Diagnostics.AddAttributeError(
-	// // 		path.Root("access_key"),
-	// // 		"Missing Access Key",
-	// // 		"The provider cannot create the AWS client as there is a missing or empty value for the Access Key. ",
-	// // 	)
-	// // }
-
-	// // if secret_key == "" {
-	// // 	resp.Diagnostics.AddAttributeError(
-	// // 		path.Root("secret_key"),
-	// // 		"Missing Secret Key",
-	// // 		"The provider cannot create the AWS client as there is a missing or empty value for the Secret Key. ",
-	// // 	)
-	// // }
-	// // if resp.Diagnostics.HasError() {
-	// // 	return
-	// // }
+	retry := retryConfig{
+		maxRetries: config.MaxRetries.ValueInt64(),
+		delay:      parseDurationAttribute(config.RetryDelay, path.Root("retry_delay"), time.Second, &resp.Diagnostics),
+	}
+	timeouts := parseOperationTimeouts(config.Timeouts, &resp.Diagnostics)
+	if resp.Diagnostics.HasError() {
+		return
+	}
 
-	// Create Docker client
-	apiClient, err := client.NewClientWithOpts(client.WithAPIVersionNegotiation())
+	userAgent := "terraform-provider-docker/" + p.version
+	if config.UserAgentSuffix.ValueString() != "" {
+		userAgent = userAgent + " " + config.UserAgentSuffix.ValueString()
+	}
+
+	configDir, err := dockerConfigDir(config.ConfigPath)
 	if err != nil {
-		fmt.Println(err)
+		resp.Diagnostics.AddAttributeError(
+			path.Root("config_path"),
+			"Unable to locate Docker config directory",
+			"Could not locate Docker config directory, unexpected error: "+err.Error(),
+		)
 		return
 	}
 
+	var audit *auditLog
+	if config.AuditLogFile.ValueString() != "" {
+		audit, err = newAuditLog(config.AuditLogFile.ValueString())
+		if err != nil {
+			resp.Diagnostics.AddAttributeError(
+				path.Root("audit_log_file"),
+				"Unable to open audit log file",
+				"Could not open audit log file "+config.AuditLogFile.ValueString()+", unexpected error: "+err.Error(),
+			)
+			return
+		}
+	}
+
+	// Requests that the provider makes to registries itself, rather than
+	// through the daemon, are attributed and audited the same way
+	transports := newRegistryTransports(userAgent, audit)
+
+	var apiClient *client.Client
+	if !config.RegistryOnly.ValueBool() {
+		apiClient = newDockerClient(ctx, config, configDir, userAgent, audit, &resp.Diagnostics)
+		if resp.Diagnostics.HasError() {
+			return
+		}
+	}
+
+	registryAuths := map[string]registry.AuthConfig{}
+	for index, item := range config.RegistryAuth {
+		address := item.Address.ValueString()
+
+		authConfig := registry.AuthConfig{
+			Username:      item.Username.ValueString(),
+			Password:      item.Password.ValueString(),
+			ServerAddress: address,
+		}
+
+		if item.ConfigFile.ValueString() != "" {
+			authConfig, err = loadConfigFileAuth(item.ConfigFile.ValueString(), address)
+			if err != nil {
+				resp.Diagnostics.AddAttributeError(
+					path.Root("registry_auth").AtListIndex(index).AtName("config_file"),
+					"Unable to read registry credentials",
+					"Could not read credentials for "+address+": "+err.Error(),
+				)
+				return
+			}
+		}
+
+		if item.Azure != nil {
+			identity := azureRegistryAuth{
+				tenantID:        valueOrEnv(item.Azure.TenantID, "AZURE_TENANT_ID"),
+				clientID:        valueOrEnv(item.Azure.ClientID, "AZURE_CLIENT_ID"),
+				clientSecret:    valueOrEnv(item.Azure.ClientSecret, "AZURE_CLIENT_SECRET"),
+				managedIdentity: item.Azure.ManagedIdentity.ValueBool(),
+			}
+
+			authConfig, err = acrAuthConfig(ctx, transports.httpClient(false), address, identity)
+			if err != nil {
+				resp.Diagnostics.AddAttributeError(
+					path.Root("registry_auth").AtListIndex(index).AtName("azure"),
+					"Unable to get Azure Container Registry token",
+					"Could not get a token for "+address+": "+err.Error(),
+				)
+				return
+			}
+		}
+
+		registryAuths[normalizeRegistryAddress(address)] = authConfig
+	}
+
+	insecureRegistries := map[string]bool{}
+	for _, address := range config.InsecureRegistries {
+		insecureRegistries[normalizeRegistryAddress(address)] = true
+	}
+
 	// Make the Docker client available during DataSource and Resource
 	// type Configure methods.
-	resp.DataSourceData = apiClient
-	resp.ResourceData = apiClient
+	providerData := &dockerProviderData{
+		client:             apiClient,
+		registryAuths:      registryAuths,
+		insecureRegistries: insecureRegistries,
+		registryTransports: transports,
+		configDir:          configDir,
+		retry:              retry,
+		timeouts:           timeouts,
+	}
+	resp.DataSourceData = providerData
+	resp.ResourceData = providerData
+}
+
+// newDockerClient creates the client for the Docker daemon selected by the
+// provider configuration and checks that the daemon can be reached.
+func newDockerClient(ctx context.Context, config dockerProviderModel, configDir string, userAgent string, audit *auditLog, diagnostics *diag.Diagnostics) *client.Client {
+	clientOpts := []client.Opt{
+		client.WithUserAgent(userAgent),
+	}
+
+	apiVersion := valueOrEnv(config.APIVersion, "DOCKER_API_VERSION")
+	if apiVersion != "" {
+		clientOpts = append(clientOpts, client.WithVersion(apiVersion))
+	} else {
+		clientOpts = append(clientOpts, client.WithAPIVersionNegotiation())
+	}
+
+	// Endpoint and TLS material of a named context are used unless they are
+	// set explicitly on the provider. Without a context, unset values fall
+	// back to the environment variables read by the docker CLI, as with
+	// client.FromEnv.
+	host := config.Host.ValueString()
+	certPath := config.CertPath.ValueString()
+	tlsMaterial := tlsMaterial{}
+	tlsVerify := config.TLSVerify.IsNull() || config.TLSVerify.ValueBool()
+	useTLS := config.TLSVerify.ValueBool()
+	if config.Context.ValueString() == "" {
+		host = valueOrEnv(config.Host, "DOCKER_HOST")
+		certPath = valueOrEnv(config.CertPath, "DOCKER_CERT_PATH")
+
+		// Certificates from DOCKER_CERT_PATH are only verified if
+		// DOCKER_TLS_VERIFY is set
+		if config.TLSVerify.IsNull() {
+			useTLS = os.Getenv("DOCKER_TLS_VERIFY") != ""
+			if config.CertPath.ValueString() == "" && certPath != "" {
+				tlsVerify = useTLS
+			}
+		}
+	} else {
+		dockerContext, err := loadDockerContext(configDir, config.Context.ValueString())
+		if err != nil {
+			diagnostics.AddAttributeError(
+				path.Root("context"),
+				"Unable to read Docker context",
+				"Could not read Docker context "+config.Context.ValueString()+": "+err.Error(),
+			)
+			return nil
+		}
+
+		if host == "" {
+			host = dockerContext.Host
+		}
+		if config.TLSVerify.IsNull() {
+			tlsVerify = !dockerContext.SkipTLSVerify
+		}
+		tlsMaterial = dockerContext.TLS
+	}
+
+	if host != "" {
+		// ssh:// hosts are reached by running "docker system dial-stdio" on
+		// the remote host, the same way the docker CLI does.
+		helper, err := connhelper.GetConnectionHelperWithSSHOpts(host, config.SSHOpts)
+		if err != nil {
+			diagnostics.AddAttributeError(
+				path.Root("host"),
+				"Invalid Docker host",
+				"Could not use Docker host "+host+": "+err.Error(),
+			)
+			return nil
+		}
+
+		if helper != nil {
+			clientOpts = append(clientOpts,
+				client.WithHTTPClient(&http.Client{Transport: &http.Transport{DialContext: helper.Dialer}}),
+				client.WithHost(helper.Host),
+				client.WithDialContext(helper.Dialer),
+			)
+		} else {
+			clientOpts = append(clientOpts, client.WithHost(host))
+		}
+	}
+
+	// Material set inline takes precedence over the files in cert_path
+	if certPath != "" {
+		certPathMaterial, err := loadTLSMaterial(certPath)
+		if err != nil {
+			diagnostics.AddAttributeError(
+				path.Root("cert_path"),
+				"Unable to read TLS material",
+				"Could not read TLS material from cert_path, unexpected error: "+err.Error(),
+			)
+			return nil
+		}
+		tlsMaterial = certPathMaterial
+	}
+	if config.CaMaterial.ValueString() != "" {
+		tlsMaterial.ca = []byte(config.CaMaterial.ValueString())
+	}
+	if config.CertMaterial.ValueString() != "" {
+		tlsMaterial.cert = []byte(config.CertMaterial.ValueString())
+	}
+	if config.KeyMaterial.ValueString() != "" {
+		tlsMaterial.key = []byte(config.KeyMaterial.ValueString())
+	}
+
+	if tlsMaterial.isSet() || useTLS {
+		clientOpts = append(clientOpts, withTLSMaterial(tlsMaterial, tlsVerify))
+	}
+
+	if config.HTTPProxy.ValueString() != "" || config.HTTPSProxy.ValueString() != "" {
+		clientOpts = append(clientOpts, withProxy(&httpproxy.Config{
+			HTTPProxy:  config.HTTPProxy.ValueString(),
+			HTTPSProxy: config.HTTPSProxy.ValueString(),
+			NoProxy:    config.NoProxy.ValueString(),
+		}))
+	}
+
+	settings := connectionSettings{
+		connectTimeout:  parseDurationAttribute(config.ConnectTimeout, path.Root("connect_timeout"), 10*time.Second, diagnostics),
+		requestTimeout:  parseDurationAttribute(config.RequestTimeout, path.Root("request_timeout"), 0, diagnostics),
+		keepAlive:       parseDurationAttribute(config.KeepAlive, path.Root("keep_alive"), 0, diagnostics),
+		idleConnTimeout: parseDurationAttribute(config.IdleConnTimeout, path.Root("idle_conn_timeout"), 0, diagnostics),
+	}
+	if diagnostics.HasError() {
+		return nil
+	}
+
+	// A keep-alive interval of zero means the Go default, so disabling
+	// keep-alive probes needs a negative value
+	if !config.KeepAlive.IsNull() && settings.keepAlive == 0 {
+		settings.keepAlive = -1
+	}
+	clientOpts = append(clientOpts, withConnectionSettings(settings))
+
+	// Wrap the transport, so they have to be applied after any option that
+	// configures the underlying *http.Transport.
+	if config.Debug.ValueBool() {
+		clientOpts = append(clientOpts, withDebugLogging())
+	}
+	if audit != nil {
+		clientOpts = append(clientOpts, withAuditLog(audit))
+	}
+
+	// Create Docker client
+	apiClient, err := client.NewClientWithOpts(clientOpts...)
+	if err != nil {
+		diagnostics.AddError(
+			"Unable to create Docker client",
+			"Could not create Docker client, unexpected error: "+err.Error(),
+		)
+		return nil
+	}
+
+	// Fails fast if the daemon is unreachable, rather than on first use
+	_, err = apiClient.Ping(ctx)
+	if err != nil {
+		// The client of an ssh:// host connects to the local end of the
+		// connection helper, so the configured host is reported instead
+		daemonHost := host
+		if daemonHost == "" {
+			daemonHost = apiClient.DaemonHost()
+		}
+		diagnostics.AddError(
+			"Unable to connect to Docker daemon",
+			daemonUnreachableDetail(daemonHost, err),
+		)
+		return nil
+	}
+
+	if apiVersion != "" {
+		serverVersion, err := apiClient.ServerVersion(ctx)
+		if err != nil {
+			diagnostics.AddError(
+				"Unable to get Docker daemon version",
+				"Could not check that the daemon supports API version "+apiVersion+": "+err.Error(),
+			)
+			return nil
+		}
+
+		if versions.LessThan(apiVersion, serverVersion.MinAPIVersion) || versions.GreaterThan(apiVersion, serverVersion.APIVersion) {
+			diagnostics.AddAttributeError(
+				path.Root("api_version"),
+				"Unsupported Docker API version",
+				fmt.Sprintf("API version %s is not supported by Docker daemon %s, which supports API versions %s to %s.", apiVersion, serverVersion.Version, serverVersion.MinAPIVersion, serverVersion.APIVersion),
+			)
+			return nil
+		}
+	}
+
+	return apiClient
 }
 
 // DataSources defines the data sources implemented in the provider.
@@ -165,5 +608,50 @@ func (p *dockerProvider) Resources(_ context.Context) []func() resource.Resource
 	return []func() resource.Resource{
 		NewImageResource,
 		NewImagePushResource,
+		NewImageLoadResource,
+		NewImageCopyResource,
+		NewNetworkResource,
+		NewConfigResource,
+		NewBuildCachePruneResource,
+	}
+}
+
+// valueOrEnv returns the configured value, or the environment variable key if
+// the value is not set.
+func valueOrEnv(value types.String, key string) string {
+	if value.ValueString() != "" {
+		return value.ValueString()
+	}
+
+	return os.Getenv(key)
+}
+
+// requireDaemon adds an error to diagnostics if the provider was configured
+// without a Docker daemon, which typeName needs.
+func (d *dockerProviderData) requireDaemon(typeName string, diagnostics *diag.Diagnostics) {
+	if d.client == nil {
+		diagnostics.AddError(
+			"Docker daemon required",
+			typeName+" requires a Docker daemon, but the provider is configured with registry_only.",
+		)
+	}
+}
+
+// parseDurationAttribute parses a duration attribute such as "30s", returning
+// defaultValue if it is not set.
+func parseDurationAttribute(value types.String, attributePath path.Path, defaultValue time.Duration, diagnostics *diag.Diagnostics) time.Duration {
+	if value.ValueString() == "" {
+		return defaultValue
+	}
+
+	duration, err := time.ParseDuration(value.ValueString())
+	if err != nil {
+		diagnostics.AddAttributeError(
+			attributePath,
+			"Invalid duration",
+			"Could not parse "+attributePath.String()+" as a duration, e.g. \"30s\": "+err.Error(),
+		)
 	}
+
+	return duration
 }
@@ -0,0 +1,214 @@
+package provider
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/distribution/reference"
+	"github.com/docker/docker/api/types/registry"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+// Address under which the daemon and the docker CLI store Docker Hub
+// credentials.
+const dockerHubIndexServer = "https://index.docker.io/v1/"
+
+// Registry addresses that all refer to Docker Hub.
+var dockerHubAddresses = map[string]bool{
+	"docker.io":            true,
+	"index.docker.io":      true,
+	"registry-1.docker.io": true,
+}
+
+// normalizeRegistryAddress reduces a registry address such as
+// https://index.docker.io/v1/ to its host, so that credentials can be looked
+// up per registry host.
+func normalizeRegistryAddress(address string) string {
+	address = strings.TrimPrefix(address, "https://")
+	address = strings.TrimPrefix(address, "http://")
+	address = strings.SplitN(address, "/", 2)[0]
+	address = strings.ToLower(address)
+
+	if dockerHubAddresses[address] {
+		return "docker.io"
+	}
+
+	return address
+}
+
+// registryAddressFromImage returns the registry host of an image reference,
+// e.g. "docker.io" for "alpine:3.20".
+func registryAddressFromImage(image string) (string, error) {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return "", err
+	}
+
+	return normalizeRegistryAddress(reference.Domain(named)), nil
+}
+
+// dockerConfigFile maps the parts of a docker CLI config.json that hold
+// registry credentials.
+type dockerConfigFile struct {
+	Auths       map[string]registry.AuthConfig `json:"auths"`
+	CredsStore  string                         `json:"credsStore"`
+	CredHelpers map[string]string              `json:"credHelpers"`
+}
+
+// errCredentialsNotFound is returned when no credentials are stored for a
+// registry, as opposed to the credentials being unreadable.
+var errCredentialsNotFound = errors.New("credentials not found")
+
+// loadConfigFileAuth reads the credentials stored for address in the docker
+// CLI config file at configFile. Like the docker CLI, a credential helper
+// configured for the registry in credHelpers takes precedence over credsStore,
+// which takes precedence over the auths stored in the file itself.
+func loadConfigFileAuth(configFile string, address string) (registry.AuthConfig, error) {
+	authConfig := registry.AuthConfig{}
+
+	content, err := os.ReadFile(configFile)
+	if err != nil {
+		return authConfig, err
+	}
+
+	var dockerConfig dockerConfigFile
+	if err := json.Unmarshal(content, &dockerConfig); err != nil {
+		return authConfig, fmt.Errorf("unable to parse %s: %w", configFile, err)
+	}
+
+	for helperAddress, helper := range dockerConfig.CredHelpers {
+		if normalizeRegistryAddress(helperAddress) == normalizeRegistryAddress(address) {
+			return credentialHelperAuth(helper, address)
+		}
+	}
+
+	if dockerConfig.CredsStore != "" {
+		return credentialHelperAuth(dockerConfig.CredsStore, address)
+	}
+
+	found := false
+	for configAddress, item := range dockerConfig.Auths {
+		if normalizeRegistryAddress(configAddress) == normalizeRegistryAddress(address) {
+			authConfig = item
+			found = true
+			break
+		}
+	}
+	if !found {
+		return authConfig, fmt.Errorf("%w for %s in %s", errCredentialsNotFound, address, configFile)
+	}
+
+	// docker login stores credentials as base64 encoded "username:password"
+	if authConfig.Auth != "" {
+		decoded, err := base64.StdEncoding.DecodeString(authConfig.Auth)
+		if err != nil {
+			return authConfig, fmt.Errorf("unable to decode credentials for %s: %w", address, err)
+		}
+
+		credentials := strings.SplitN(string(decoded), ":", 2)
+		if len(credentials) != 2 {
+			return authConfig, fmt.Errorf("invalid credentials for %s in %s", address, configFile)
+		}
+		authConfig.Username = credentials[0]
+		authConfig.Password = credentials[1]
+		authConfig.Auth = ""
+	}
+
+	authConfig.ServerAddress = address
+
+	return authConfig, nil
+}
+
+// credentialHelperAuth runs docker-credential-<helper> get, e.g.
+// docker-credential-osxkeychain, to read the credentials of address as
+// described in https://github.com/docker/docker-credential-helpers.
+func credentialHelperAuth(helper string, address string) (registry.AuthConfig, error) {
+	authConfig := registry.AuthConfig{}
+
+	// Docker Hub credentials are stored under the index server URL
+	serverURL := address
+	if normalizeRegistryAddress(address) == "docker.io" {
+		serverURL = dockerHubIndexServer
+	}
+
+	cmd := exec.Command("docker-credential-"+helper, "get")
+	cmd.Stdin = strings.NewReader(serverURL)
+	stdout, err := cmd.Output()
+	if err != nil {
+		output := strings.TrimSpace(string(stdout))
+		if strings.Contains(output, "credentials not found") {
+			return authConfig, fmt.Errorf("%w for %s in docker-credential-%s", errCredentialsNotFound, address, helper)
+		}
+		return authConfig, fmt.Errorf("docker-credential-%s get failed: %w %s", helper, err, output)
+	}
+
+	var credentials struct {
+		Username string
+		Secret   string
+	}
+	if err := json.Unmarshal(stdout, &credentials); err != nil {
+		return authConfig, fmt.Errorf("unable to parse output of docker-credential-%s: %w", helper, err)
+	}
+
+	// Helpers return "<token>" as username when the secret is an identity token
+	if credentials.Username == "<token>" {
+		authConfig.IdentityToken = credentials.Secret
+	} else {
+		authConfig.Username = credentials.Username
+		authConfig.Password = credentials.Secret
+	}
+	authConfig.ServerAddress = address
+
+	return authConfig, nil
+}
+
+// registryAuthForImage returns the encoded credentials for the registry of
+// image. Credentials from the registry_auth blocks of the provider are used
+// first, then the ones stored by docker login in the config.json in
+// configDir. An empty string is returned if there are none. For registries
+// listed in insecureRegistries, credentials that cannot be read are not an
+// error either, and the image is pushed or pulled anonymously.
+func registryAuthForImage(ctx context.Context, registryAuths map[string]registry.AuthConfig, insecureRegistries map[string]bool, configDir string, image string) (string, error) {
+	address, err := registryAddressFromImage(image)
+	if err != nil {
+		return "", err
+	}
+
+	authConfig, ok := registryAuths[address]
+	if !ok {
+		authConfig, err = loadConfigFileAuth(filepath.Join(configDir, "config.json"), address)
+		if errors.Is(err, os.ErrNotExist) || errors.Is(err, errCredentialsNotFound) {
+			return "", nil
+		}
+		if err != nil && insecureRegistries[address] {
+			tflog.Warn(ctx, "Using no credentials for insecure registry "+address+": "+err.Error())
+			return "", nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return registry.EncodeAuthConfig(authConfig)
+}
+
+// buildAuthConfigs keys the provider credentials the way the daemon looks
+// them up when pulling parent images during a build.
+func buildAuthConfigs(registryAuths map[string]registry.AuthConfig) map[string]registry.AuthConfig {
+	authConfigs := map[string]registry.AuthConfig{}
+	for address, authConfig := range registryAuths {
+		if address == "docker.io" {
+			address = dockerHubIndexServer
+		}
+		authConfigs[address] = authConfig
+	}
+
+	return authConfigs
+}
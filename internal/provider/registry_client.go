@@ -0,0 +1,498 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/distribution/reference"
+	"github.com/docker/docker/api/types/registry"
+	"github.com/opencontainers/go-digest"
+)
+
+// Media types of the manifests that a tag can point at.
+var manifestMediaTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// errManifestNotFound is returned when a registry has no manifest for a tag.
+var errManifestNotFound = errors.New("manifest not found")
+
+// registryClient talks to the Registry HTTP API V2 of one registry, for the
+// few operations that the daemon does not offer, such as deleting a
+// manifest. It authenticates with authConfig, either directly with basic
+// auth or through the token server named in the challenge of the registry.
+type registryClient struct {
+	baseURL    string
+	authConfig registry.AuthConfig
+	httpClient *http.Client
+	insecure   bool
+
+	// Authorization header of the requests, once challenged
+	authorization string
+}
+
+// registryTransports carry the requests that the provider makes to
+// registries itself, with the User-Agent of the provider and, if set, to its
+// audit log. Their connections are shared by all registry clients of a
+// provider.
+type registryTransports struct {
+	secure   http.RoundTripper
+	insecure http.RoundTripper
+}
+
+// newRegistryTransports returns the transports of the registry requests of
+// a provider, recording them to audit if it is not nil.
+func newRegistryTransports(userAgent string, audit *auditLog) *registryTransports {
+	wrap := func(transport http.RoundTripper) http.RoundTripper {
+		transport = &userAgentTransport{next: transport, userAgent: userAgent}
+		if audit != nil {
+			transport = &auditTransport{next: transport, log: audit, registry: true}
+		}
+		return transport
+	}
+
+	insecure := http.DefaultTransport.(*http.Transport).Clone()
+	insecure.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+
+	return &registryTransports{
+		secure:   wrap(http.DefaultTransport.(*http.Transport).Clone()),
+		insecure: wrap(insecure),
+	}
+}
+
+// defaultRegistryTransports carry the registry requests of clients created
+// without a configured provider, e.g. in tests.
+var defaultRegistryTransports = newRegistryTransports("terraform-provider-docker", nil)
+
+// httpClient returns a client for the requests to a registry. Insecure
+// registries may serve an untrusted certificate.
+func (t *registryTransports) httpClient(insecure bool) *http.Client {
+	if t == nil {
+		t = defaultRegistryTransports
+	}
+	if insecure {
+		return &http.Client{Transport: t.insecure}
+	}
+	return &http.Client{Transport: t.secure}
+}
+
+// newRegistryClient returns a client for the registry at address, e.g.
+// "docker.io" or "registry.local:5000", whose requests are made through
+// transports. Insecure registries may serve an untrusted certificate or plain
+// HTTP.
+func newRegistryClient(address string, authConfig registry.AuthConfig, insecure bool, transports *registryTransports) *registryClient {
+	if address == "docker.io" {
+		address = "registry-1.docker.io"
+	}
+
+	return &registryClient{
+		baseURL:    "https://" + address,
+		authConfig: authConfig,
+		httpClient: transports.httpClient(insecure),
+		insecure:   insecure,
+	}
+}
+
+// registryClientForImage returns a client for the registry of image, with the
+// encoded credentials registryAuth, along with the path of the repository of
+// image in the registry.
+func registryClientForImage(image string, registryAuth string, insecureRegistries map[string]bool, transports *registryTransports) (*registryClient, string, error) {
+	address, err := registryAddressFromImage(image)
+	if err != nil {
+		return nil, "", err
+	}
+	repository, err := repositoryPath(image)
+	if err != nil {
+		return nil, "", err
+	}
+	authConfig, err := registry.DecodeAuthConfig(registryAuth)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return newRegistryClient(address, *authConfig, insecureRegistries[address], transports), repository, nil
+}
+
+// repositoryPath returns the path of the repository of image in its
+// registry, e.g. "library/alpine" for "alpine:3.20".
+func repositoryPath(image string) (string, error) {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return "", err
+	}
+
+	return reference.Path(named), nil
+}
+
+// manifestDigest returns the digest of the manifest that reference, a tag or
+// digest, points at in repository.
+func (c *registryClient) manifestDigest(ctx context.Context, repository string, reference string) (string, error) {
+	header := http.Header{"Accept": {strings.Join(manifestMediaTypes, ", ")}}
+	resp, err := c.do(ctx, http.MethodHead, "/v2/"+repository+"/manifests/"+reference, header, nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return "", errManifestNotFound
+	case resp.StatusCode != http.StatusOK:
+		return "", fmt.Errorf("unable to read manifest %s of %s: unexpected status %s", reference, repository, resp.Status)
+	case resp.Header.Get("Docker-Content-Digest") == "":
+		return "", fmt.Errorf("unable to read manifest %s of %s: no digest in response", reference, repository)
+	}
+
+	return resp.Header.Get("Docker-Content-Digest"), nil
+}
+
+// deleteManifest deletes the manifest with digest from repository, along
+// with all the tags that point at it. A manifest that does not exist is not
+// an error.
+func (c *registryClient) deleteManifest(ctx context.Context, repository string, digest string) error {
+	resp, err := c.do(ctx, http.MethodDelete, "/v2/"+repository+"/manifests/"+digest, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusAccepted, http.StatusOK, http.StatusNotFound:
+		return nil
+	case http.StatusMethodNotAllowed:
+		return fmt.Errorf("the registry does not allow deleting manifests, e.g. because REGISTRY_STORAGE_DELETE_ENABLED is not set on a registry:2 instance")
+	default:
+		return fmt.Errorf("unable to delete manifest %s of %s: unexpected status %s", digest, repository, resp.Status)
+	}
+}
+
+// getManifest returns the manifest that reference, a tag or digest, points
+// at in repository, along with its media type and digest.
+func (c *registryClient) getManifest(ctx context.Context, repository string, reference string) ([]byte, string, string, error) {
+	header := http.Header{"Accept": {strings.Join(manifestMediaTypes, ", ")}}
+	resp, err := c.do(ctx, http.MethodGet, "/v2/"+repository+"/manifests/"+reference, header, nil)
+	if err != nil {
+		return nil, "", "", err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, "", "", errManifestNotFound
+	default:
+		return nil, "", "", fmt.Errorf("unable to read manifest %s of %s: unexpected status %s", reference, repository, resp.Status)
+	}
+
+	manifest, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	// Registries may omit the digest of manifests fetched by digest
+	manifestDigest := resp.Header.Get("Docker-Content-Digest")
+	if manifestDigest == "" {
+		manifestDigest = digest.FromBytes(manifest).String()
+	}
+
+	return manifest, resp.Header.Get("Content-Type"), manifestDigest, nil
+}
+
+// putManifest uploads manifest of mediaType to repository as reference, a tag
+// or its digest.
+func (c *registryClient) putManifest(ctx context.Context, repository string, reference string, manifest []byte, mediaType string) error {
+	header := http.Header{"Content-Type": {mediaType}}
+	resp, err := c.do(ctx, http.MethodPut, "/v2/"+repository+"/manifests/"+reference, header, bytes.NewReader(manifest))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("unable to upload manifest %s of %s: unexpected status %s: %s", reference, repository, resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	return nil
+}
+
+// blobExists reports whether repository has the blob with digest.
+func (c *registryClient) blobExists(ctx context.Context, repository string, digest string) (bool, error) {
+	resp, err := c.do(ctx, http.MethodHead, "/v2/"+repository+"/blobs/"+digest, nil, nil)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("unable to check blob %s of %s: unexpected status %s", digest, repository, resp.Status)
+	}
+}
+
+// getBlob returns the content of the blob with digest in repository, which
+// the caller must close.
+func (c *registryClient) getBlob(ctx context.Context, repository string, digest string) (io.ReadCloser, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/v2/"+repository+"/blobs/"+digest, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unable to read blob %s of %s: unexpected status %s", digest, repository, resp.Status)
+	}
+
+	return resp.Body, nil
+}
+
+// mountBlob asks the registry to link the blob with digest from the
+// repository from into repository, which saves uploading it again. It
+// reports whether the registry did, or the URL to upload the blob to
+// otherwise.
+func (c *registryClient) mountBlob(ctx context.Context, repository string, digest string, from string) (bool, string, error) {
+	query := url.Values{}
+	if from != "" {
+		query.Set("mount", digest)
+		query.Set("from", from)
+	}
+
+	resp, err := c.do(ctx, http.MethodPost, "/v2/"+repository+"/blobs/uploads/?"+query.Encode(), nil, nil)
+	if err != nil {
+		return false, "", err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusCreated:
+		return true, "", nil
+	case http.StatusAccepted:
+	default:
+		return false, "", fmt.Errorf("unable to start upload of blob %s to %s: unexpected status %s", digest, repository, resp.Status)
+	}
+
+	location, err := resp.Request.URL.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		return false, "", err
+	}
+
+	return false, location.String(), nil
+}
+
+// uploadBlob uploads the blob with digest and size, read from blob, in a
+// single request to location, as returned by mountBlob.
+func (c *registryClient) uploadBlob(ctx context.Context, location string, digest string, size int64, blob io.Reader) error {
+	uploadURL, err := url.Parse(location)
+	if err != nil {
+		return err
+	}
+	query := uploadURL.Query()
+	query.Set("digest", digest)
+	uploadURL.RawQuery = query.Encode()
+
+	header := http.Header{
+		"Content-Type":   {"application/octet-stream"},
+		"Content-Length": {strconv.FormatInt(size, 10)},
+	}
+	resp, err := c.do(ctx, http.MethodPut, uploadURL.String(), header, blob)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("unable to upload blob %s: unexpected status %s: %s", digest, resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	return nil
+}
+
+// do sends a request to the registry, authenticating and sending it again if
+// the registry challenges it, e.g. for a token with a wider scope. Requests
+// with a body are only sent again if body can be rewound.
+func (c *registryClient) do(ctx context.Context, method string, path string, header http.Header, body io.Reader) (*http.Response, error) {
+	resp, err := c.send(ctx, method, path, header, body)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	seeker, rewindable := body.(io.Seeker)
+	if body != nil && !rewindable {
+		return resp, nil
+	}
+	resp.Body.Close()
+
+	if err := c.authorize(ctx, resp.Header.Get("WWW-Authenticate")); err != nil {
+		return nil, err
+	}
+	if rewindable {
+		if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+
+	return c.send(ctx, method, path, header, body)
+}
+
+// send sends a request to path, relative to the registry, or to an absolute
+// URL such as the Location of a blob upload.
+func (c *registryClient) send(ctx context.Context, method string, path string, header http.Header, body io.Reader) (*http.Response, error) {
+	requestURL := path
+	if !strings.HasPrefix(path, "http://") && !strings.HasPrefix(path, "https://") {
+		requestURL = c.baseURL + path
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, requestURL, body)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if contentLength := req.Header.Get("Content-Length"); contentLength != "" {
+		req.ContentLength, _ = strconv.ParseInt(contentLength, 10, 64)
+		req.Header.Del("Content-Length")
+	}
+	if c.authorization != "" {
+		req.Header.Set("Authorization", c.authorization)
+	}
+
+	resp, err := c.httpClient.Do(req)
+
+	// Insecure registries may only serve plain HTTP
+	if err != nil && c.insecure && strings.HasPrefix(requestURL, "https://") && body == nil && ctx.Err() == nil {
+		c.baseURL = "http://" + strings.TrimPrefix(c.baseURL, "https://")
+		return c.send(ctx, method, "http://"+strings.TrimPrefix(requestURL, "https://"), header, body)
+	}
+
+	return resp, err
+}
+
+// authorize sets the Authorization header of the requests from the
+// WWW-Authenticate challenge of the registry.
+func (c *registryClient) authorize(ctx context.Context, challenge string) error {
+	scheme, params := parseAuthChallenge(challenge)
+
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if c.authConfig.Username == "" {
+			return fmt.Errorf("the registry requires credentials")
+		}
+		req, _ := http.NewRequest(http.MethodGet, c.baseURL, nil)
+		req.SetBasicAuth(c.authConfig.Username, c.authConfig.Password)
+		c.authorization = req.Header.Get("Authorization")
+		return nil
+	case "bearer":
+		token, err := c.fetchToken(ctx, params)
+		if err != nil {
+			return err
+		}
+		c.authorization = "Bearer " + token
+		return nil
+	default:
+		return fmt.Errorf("unsupported authentication challenge %q", challenge)
+	}
+}
+
+// fetchToken returns a bearer token from the token server of a Bearer
+// challenge, for the scope of the challenge.
+func (c *registryClient) fetchToken(ctx context.Context, params map[string]string) (string, error) {
+	if c.authConfig.RegistryToken != "" {
+		return c.authConfig.RegistryToken, nil
+	}
+	if params["realm"] == "" {
+		return "", fmt.Errorf("the authentication challenge of the registry has no realm")
+	}
+
+	query := url.Values{}
+	if params["service"] != "" {
+		query.Set("service", params["service"])
+	}
+	if params["scope"] != "" {
+		query.Set("scope", params["scope"])
+	}
+
+	var req *http.Request
+	var err error
+	if c.authConfig.IdentityToken != "" {
+		// Identity tokens are OAuth2 refresh tokens
+		query.Set("grant_type", "refresh_token")
+		query.Set("refresh_token", c.authConfig.IdentityToken)
+		query.Set("client_id", "terraform-provider-docker")
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, params["realm"], strings.NewReader(query.Encode()))
+		if err == nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+	} else {
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, params["realm"]+"?"+query.Encode(), nil)
+		if err == nil && c.authConfig.Username != "" {
+			req.SetBasicAuth(c.authConfig.Username, c.authConfig.Password)
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("unable to get a token from %s: unexpected status %s: %s", params["realm"], resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("unable to parse token from %s: %w", params["realm"], err)
+	}
+	if token.Token != "" {
+		return token.Token, nil
+	}
+
+	return token.AccessToken, nil
+}
+
+// parseAuthChallenge splits a WWW-Authenticate header such as
+// `Bearer realm="https://auth.docker.io/token",service="registry.docker.io"`
+// into its scheme and parameters.
+func parseAuthChallenge(challenge string) (string, map[string]string) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(challenge), " ")
+	params := map[string]string{}
+
+	for rest != "" {
+		var key, value string
+		key, rest, _ = strings.Cut(strings.TrimLeft(rest, " ,"), "=")
+		if strings.HasPrefix(rest, `"`) {
+			value, rest, _ = strings.Cut(rest[1:], `"`)
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+		if key != "" {
+			params[strings.ToLower(strings.TrimSpace(key))] = value
+		}
+	}
+
+	return scheme, params
+}
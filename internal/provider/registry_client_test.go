@@ -0,0 +1,62 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types/registry"
+)
+
+// TestRegistryClientDeleteManifest checks that a tag is deleted by the digest
+// it points at, with a token from the token server of the registry.
+func TestRegistryClientDeleteManifest(t *testing.T) {
+
+	const digest = "sha256:6a5e"
+	deleted := ""
+
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if username, password, _ := r.BasicAuth(); username != "ci" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"token": "t0k3n"}`)
+	})
+	mux.HandleFunc("/v2/team/app/manifests/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer t0k3n" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+server.URL+`/token",service="registry",scope="repository:team/app:delete"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.Method {
+		case http.MethodHead:
+			w.Header().Set("Docker-Content-Digest", digest)
+		case http.MethodDelete:
+			deleted = strings.TrimPrefix(r.URL.Path, "/v2/team/app/manifests/")
+			w.WriteHeader(http.StatusAccepted)
+		}
+	})
+
+	address := strings.TrimPrefix(server.URL, "http://")
+	registryClient := newRegistryClient(address, registry.AuthConfig{Username: "ci", Password: "secret"}, true, nil)
+
+	ctx := context.Background()
+	manifestDigest, err := registryClient.manifestDigest(ctx, "team/app", "pr-42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := registryClient.deleteManifest(ctx, "team/app", manifestDigest); err != nil {
+		t.Fatal(err)
+	}
+
+	if deleted != digest {
+		t.Fatalf("Manifest deleted is incorrect! Expected %s but found %q.", digest, deleted)
+	}
+}
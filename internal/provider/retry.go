@@ -0,0 +1,68 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/docker/docker/errdefs"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+// retryConfig controls how Engine API calls are retried on transient errors.
+type retryConfig struct {
+	maxRetries int64
+	delay      time.Duration
+	maxDelay   time.Duration
+}
+
+// isTransientError reports whether err is worth retrying: dropped
+// connections, timeouts and server side errors of the daemon.
+func isTransientError(err error) bool {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	return errdefs.IsSystem(err) || errdefs.IsUnavailable(err) || errdefs.IsDeadline(err)
+}
+
+// retryOnTransientError calls fn until it succeeds, fails with an error that
+// is not transient, or config.maxRetries retries have been made. The delay
+// between retries doubles after each attempt, up to config.maxDelay if set.
+func retryOnTransientError(ctx context.Context, config retryConfig, operation string, fn func() error) error {
+	return retryOnError(ctx, config, operation, isTransientError, fn)
+}
+
+// retryOnError is retryOnTransientError with retryable deciding which errors
+// are retried.
+func retryOnError(ctx context.Context, config retryConfig, operation string, retryable func(error) bool, fn func() error) error {
+	delay := config.delay
+
+	for attempt := int64(0); ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= config.maxRetries || !retryable(err) {
+			return err
+		}
+
+		tflog.Debug(ctx, fmt.Sprintf("Retrying %s in %s after transient error: %s", operation, delay, err.Error()))
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+		if config.maxDelay > 0 && delay > config.maxDelay {
+			delay = config.maxDelay
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package provider
+
+import (
+	"context"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+// operationTimeouts bounds how long Docker operations may run. Zero means no
+// timeout.
+type operationTimeouts struct {
+	build  time.Duration
+	push   time.Duration
+	delete time.Duration
+}
+
+// timeoutsModel maps the timeouts block of the provider.
+type timeoutsModel struct {
+	Build  types.String `tfsdk:"build"`
+	Push   types.String `tfsdk:"push"`
+	Delete types.String `tfsdk:"delete"`
+}
+
+// parseOperationTimeouts parses the timeouts block of the provider, which may
+// be nil if it is not configured.
+func parseOperationTimeouts(model *timeoutsModel, diagnostics *diag.Diagnostics) operationTimeouts {
+	timeouts := operationTimeouts{}
+	if model == nil {
+		return timeouts
+	}
+
+	timeouts.build = parseDurationAttribute(model.Build, path.Root("timeouts").AtName("build"), 0, diagnostics)
+	timeouts.push = parseDurationAttribute(model.Push, path.Root("timeouts").AtName("push"), 0, diagnostics)
+	timeouts.delete = parseDurationAttribute(model.Delete, path.Root("timeouts").AtName("delete"), 0, diagnostics)
+
+	return timeouts
+}
+
+// withOperationTimeout returns a context that is cancelled after the duration
+// of override, a timeout set on the resource, or after defaultTimeout
+// inherited from the provider if override is unset.
+func withOperationTimeout(ctx context.Context, override types.String, overridePath path.Path, defaultTimeout time.Duration, diagnostics *diag.Diagnostics) (context.Context, context.CancelFunc) {
+	timeout := parseDurationAttribute(override, overridePath, defaultTimeout, diagnostics)
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
@@ -0,0 +1,208 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// Operating systems, architectures and architecture variants of the images
+// that Docker can build and run.
+var (
+	platformOSes          = []string{"linux", "windows", "freebsd", "darwin"}
+	platformArchitectures = map[string][]string{
+		"amd64":    {"v1", "v2", "v3", "v4"},
+		"arm64":    {"v8", "v9"},
+		"arm":      {"v5", "v6", "v7", "v8"},
+		"386":      nil,
+		"ppc64le":  nil,
+		"s390x":    nil,
+		"riscv64":  nil,
+		"mips64le": nil,
+		"loong64":  nil,
+	}
+)
+
+// platformValidator checks that a value is a platform in the form
+// os[/arch[/variant]], e.g. "linux/arm64/v8".
+type platformValidator struct{}
+
+var _ validator.String = platformValidator{}
+
+func (v platformValidator) Description(_ context.Context) string {
+	return "value must be a platform in the form os[/arch[/variant]], e.g. linux/amd64"
+}
+
+func (v platformValidator) MarkdownDescription(ctx context.Context) string {
+	return v.Description(ctx)
+}
+
+func (v platformValidator) ValidateString(_ context.Context, req validator.StringRequest, resp *validator.StringResponse) {
+	if req.ConfigValue.IsNull() || req.ConfigValue.IsUnknown() {
+		return
+	}
+
+	if err := validatePlatform(req.ConfigValue.ValueString()); err != nil {
+		resp.Diagnostics.AddAttributeError(
+			req.Path,
+			"Invalid platform",
+			err.Error(),
+		)
+	}
+}
+
+// validatePlatform returns an error if platform is not in the form
+// os[/arch[/variant]] or names an unknown os, arch or variant.
+func validatePlatform(platform string) error {
+	parts := strings.Split(platform, "/")
+	if len(parts) > 3 || slices.Contains(parts, "") {
+		return fmt.Errorf("platform must be in the form os[/arch[/variant]], e.g. linux/amd64, got: %s", platform)
+	}
+
+	if !slices.Contains(platformOSes, parts[0]) {
+		return fmt.Errorf("unknown os %q in platform %s, expected one of %s", parts[0], platform, strings.Join(platformOSes, ", "))
+	}
+	if len(parts) == 1 {
+		return nil
+	}
+
+	variants, ok := platformArchitectures[parts[1]]
+	if !ok {
+		architectures := []string{}
+		for architecture := range platformArchitectures {
+			architectures = append(architectures, architecture)
+		}
+		slices.Sort(architectures)
+		return fmt.Errorf("unknown arch %q in platform %s, expected one of %s", parts[1], platform, strings.Join(architectures, ", "))
+	}
+	if len(parts) == 2 {
+		return nil
+	}
+
+	if !slices.Contains(variants, parts[2]) {
+		if len(variants) == 0 {
+			return fmt.Errorf("arch %q in platform %s has no variants", parts[1], platform)
+		}
+		return fmt.Errorf("unknown variant %q of arch %q in platform %s, expected one of %s", parts[2], parts[1], platform, strings.Join(variants, ", "))
+	}
+
+	return nil
+}
+
+// ociPlatform returns platform, validated with validatePlatform, as an OCI
+// platform.
+func ociPlatform(platform string) *ocispec.Platform {
+	parts := strings.Split(platform, "/")
+	ociPlatform := &ocispec.Platform{OS: parts[0]}
+	if len(parts) > 1 {
+		ociPlatform.Architecture = parts[1]
+	}
+	if len(parts) > 2 {
+		ociPlatform.Variant = parts[2]
+	}
+
+	return ociPlatform
+}
+
+// cidrValidator checks that a value is an IPv4 or IPv6 network in CIDR
+// notation, e.g. "172.28.0.0/16".
+type cidrValidator struct{}
+
+var _ validator.String = cidrValidator{}
+
+func (v cidrValidator) Description(_ context.Context) string {
+	return "value must be a network in CIDR notation, e.g. 172.28.0.0/16"
+}
+
+func (v cidrValidator) MarkdownDescription(ctx context.Context) string {
+	return v.Description(ctx)
+}
+
+func (v cidrValidator) ValidateString(_ context.Context, req validator.StringRequest, resp *validator.StringResponse) {
+	if req.ConfigValue.IsNull() || req.ConfigValue.IsUnknown() {
+		return
+	}
+
+	if _, _, err := net.ParseCIDR(req.ConfigValue.ValueString()); err != nil {
+		resp.Diagnostics.AddAttributeError(
+			req.Path,
+			"Invalid network",
+			"Could not parse "+req.ConfigValue.ValueString()+" as a network in CIDR notation, e.g. 172.28.0.0/16: "+err.Error(),
+		)
+	}
+}
+
+// templateDriverValidator checks that a value is a templating driver of Swarm
+// configs.
+type templateDriverValidator struct{}
+
+var _ validator.String = templateDriverValidator{}
+
+func (v templateDriverValidator) Description(_ context.Context) string {
+	return "value must be " + goTemplateDriver
+}
+
+func (v templateDriverValidator) MarkdownDescription(ctx context.Context) string {
+	return v.Description(ctx)
+}
+
+func (v templateDriverValidator) ValidateString(_ context.Context, req validator.StringRequest, resp *validator.StringResponse) {
+	if req.ConfigValue.IsNull() || req.ConfigValue.IsUnknown() {
+		return
+	}
+
+	if req.ConfigValue.ValueString() != goTemplateDriver {
+		resp.Diagnostics.AddAttributeError(
+			req.Path,
+			"Invalid template driver",
+			"Could not use template driver "+req.ConfigValue.ValueString()+", only "+goTemplateDriver+" is supported.",
+		)
+	}
+}
+
+// oneOfValidator checks that a value is one of values, e.g. the isolation
+// modes of Windows containers.
+type oneOfValidator struct {
+	values []string
+}
+
+var _ validator.String = oneOfValidator{}
+
+func (v oneOfValidator) Description(_ context.Context) string {
+	return "value must be one of " + quotedList(v.values)
+}
+
+func (v oneOfValidator) MarkdownDescription(ctx context.Context) string {
+	return v.Description(ctx)
+}
+
+func (v oneOfValidator) ValidateString(_ context.Context, req validator.StringRequest, resp *validator.StringResponse) {
+	if req.ConfigValue.IsNull() || req.ConfigValue.IsUnknown() {
+		return
+	}
+
+	if !slices.Contains(v.values, req.ConfigValue.ValueString()) {
+		resp.Diagnostics.AddAttributeError(
+			req.Path,
+			"Invalid value",
+			req.Path.String()+" must be one of "+quotedList(v.values)+", got: "+req.ConfigValue.ValueString(),
+		)
+	}
+}
+
+// quotedList returns values quoted and separated by commas, e.g.
+// "process", "hyperv".
+func quotedList(values []string) string {
+	quoted := []string{}
+	for _, value := range values {
+		quoted = append(quoted, strconv.Quote(value))
+	}
+
+	return strings.Join(quoted, ", ")
+}